@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/go-github/github"
+)
+
+// maxPerPage is the largest page the API serves
+const maxPerPage = 100
+
+// The Actions API is not covered by the github package, so these are its responses.
+type workflowRun struct {
+	ID int64 `json:"id"`
+}
+
+type workflowRuns struct {
+	WorkflowRuns []workflowRun `json:"workflow_runs"`
+}
+
+type workflowArtifact struct {
+	Name               string `json:"name"`
+	SizeInBytes        int64  `json:"size_in_bytes"`
+	Expired            bool   `json:"expired"`
+	ArchiveDownloadURL string `json:"archive_download_url"`
+}
+
+type workflowArtifacts struct {
+	Artifacts []workflowArtifact `json:"artifacts"`
+}
+
+// collectactions downloads the logs and artifacts of the recent workflow runs of a repo
+// and unpacks them into the documents workspace, as actions/<run>/logs/ and actions/<run>/artifacts/<name>/
+func collectactions(ctx context.Context, client *github.Client, owner string, repo string) error {
+	dir := documentDir(owner, repo, "actions") + "/"
+	maxBytes := int64(*maxDownloadSize) << 20
+
+	runs, err := listworkflowruns(ctx, client, owner, repo, *actionsRuns)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		runDir := dir + strconv.FormatInt(run.ID, 10) + "/"
+
+		// logs expire after a while, that is not a reason to give up on the rest
+		logsURL := fmt.Sprintf("repos/%v/%v/actions/runs/%d/logs", owner, repo, run.ID)
+		err := downloadZip(ctx, client, logsURL, runDir+"logs", maxBytes)
+		if err != nil {
+			fmt.Println("Skipping the logs of workflow run " + strconv.FormatInt(run.ID, 10) + " of " + owner + "/" + repo + ": " + fmt.Sprint(err))
+		}
+
+		req, err := client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/actions/runs/%d/artifacts", owner, repo, run.ID), nil)
+		if err != nil {
+			return err
+		}
+		var artifacts workflowArtifacts
+		_, err = client.Do(ctx, req, &artifacts)
+		if err != nil {
+			return err
+		}
+
+		for _, artifact := range artifacts.Artifacts {
+			if artifact.Expired || artifact.SizeInBytes > maxBytes {
+				fmt.Println("Skipping the expired or too large artifact " + artifact.Name + " of " + owner + "/" + repo)
+				continue
+			}
+			artifactDir, err := safeJoin(runDir+"artifacts", artifact.Name)
+			if err != nil {
+				return err
+			}
+			err = downloadZip(ctx, client, artifact.ArchiveDownloadURL, artifactDir, maxBytes)
+			if err != nil {
+				fmt.Println("Skipping the artifact " + artifact.Name + " of " + owner + "/" + repo + ": " + fmt.Sprint(err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// listworkflowruns lists the most recent workflow runs of a repo, a page of at most 100 runs at a time
+func listworkflowruns(ctx context.Context, client *github.Client, owner string, repo string, count int) ([]workflowRun, error) {
+	perPage := count
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	var runs []workflowRun
+	for page := 1; len(runs) < count; page++ {
+		req, err := client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/actions/runs?per_page=%d&page=%d", owner, repo, perPage, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		var pageRuns workflowRuns
+		resp, err := client.Do(ctx, req, &pageRuns)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, pageRuns.WorkflowRuns...)
+		if resp.NextPage == 0 || len(pageRuns.WorkflowRuns) == 0 {
+			break
+		}
+	}
+	if len(runs) > count {
+		runs = runs[:count]
+	}
+	return runs, nil
+}
+
+// downloadZip downloads a zip archive through the API and extracts it into dest
+func downloadZip(ctx context.Context, client *github.Client, urlStr string, dest string, maxBytes int64) error {
+	archive := dest + ".zip"
+	err := downloadAPIFile(ctx, client, urlStr, "application/vnd.github.v3+json", archive, maxBytes)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+
+	return extractArchive(archive, archive, dest, extractLimit())
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits that keep a hostile archive from filling the disk
+const (
+	maxArchiveFiles   = 10000
+	maxExtractedRatio = 100
+)
+
+// extractLimit is the most bytes extracted from an archive downloaded under the download size cap
+func extractLimit() int64 {
+	return int64(*maxDownloadSize) << 20 * maxExtractedRatio
+}
+
+// safeJoin joins an archive entry name to dest, refusing names that would escape it
+func safeJoin(dest string, name string) (string, error) {
+	name = filepath.FromSlash(strings.Replace(name, "\\", "/", -1))
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	target := filepath.Join(dest, name)
+	if target != filepath.Clean(dest) && !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %q escapes the extraction directory", name)
+	}
+	return target, nil
+}
+
+// isArchive reports whether name looks like an archive extractArchive can extract
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".jar", ".war", ".ear", ".tar", ".tgz", ".gz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArchive extracts the archive at src into dest, picking the format from its file name
+func extractArchive(src string, name string, dest string, maxBytes int64) error {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return extractTar(src, dest, true, maxBytes)
+	case strings.HasSuffix(lower, ".tar"):
+		return extractTar(src, dest, false, maxBytes)
+	case strings.HasSuffix(lower, ".gz"):
+		base := filepath.Base(name)
+		return extractGzip(src, filepath.Join(dest, base[:len(base)-len(".gz")]), maxBytes)
+	case isArchive(name):
+		return extractZip(src, dest, maxBytes)
+	}
+	return fmt.Errorf("%s is not a known archive format", name)
+}
+
+// extractZip extracts the regular files of a zip archive into dest.
+// Symlinks are skipped and extraction stops once maxBytes or maxArchiveFiles is reached.
+func extractZip(src string, dest string, maxBytes int64) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if len(r.File) > maxArchiveFiles {
+		return fmt.Errorf("%s has %d entries, more than the limit of %d", src, len(r.File), maxArchiveFiles)
+	}
+
+	var written int64
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		target, err := safeJoin(dest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		n, err := writeLimited(target, rc, maxBytes-written)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+	return nil
+}
+
+// extractTar extracts the regular files of a tar archive, optionally gzipped, into dest.
+// The same limits as for zip archives apply.
+func extractTar(src string, dest string, gzipped bool, maxBytes int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var written int64
+	return walkTar(r, func(name string, r io.Reader) error {
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return err
+		}
+		n, err := writeLimited(target, r, maxBytes-written)
+		written += n
+		return err
+	})
+}
+
+// extractGzip decompresses a single gzipped file to dest
+func extractGzip(src string, dest string, maxBytes int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	_, err = writeLimited(dest, gz, maxBytes)
+	return err
+}
+
+// writeLimited copies r into a new file at path, failing once more than limit bytes are read.
+// Sizes declared by archive headers and servers can't be trusted, so the bytes are counted as they come.
+func writeLimited(path string, r io.Reader, limit int64) (int64, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(r, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		os.Remove(path)
+		return n, fmt.Errorf("writing %s went over the size limit of %d bytes", path, limit)
+	}
+	return n, nil
+}
+
+// archiveScan scans the files inside an archive without extracting it to disk.
+// The limits are shared by all the archives nested in one top level archive.
+type archiveScan struct {
+	rules  *ruleSet
+	budget int64
+}
+
+// scanArchive scans the content of the archive found at path, reporting findings inside it
+// with a compound path such as dist/app.jar!/config/app.properties
+func scanArchive(content []byte, path string, rules *ruleSet) []truffleHogOutput {
+	if *archiveDepth == 0 {
+		return nil
+	}
+	s := &archiveScan{rules: rules, budget: int64(*maxArchiveSize) << 20 * maxExtractedRatio}
+	findings, err := s.scan(content, path, 1)
+	if err != nil {
+		fmt.Println("Stopped scanning the archive " + path + ": " + fmt.Sprint(err))
+	}
+	return findings
+}
+
+func (s *archiveScan) scan(content []byte, path string, depth int) ([]truffleHogOutput, error) {
+	var findings []truffleHogOutput
+
+	err := walkArchive(content, path, func(name string, r io.Reader) error {
+		entry, err := s.read(r)
+		if err != nil || entry == nil {
+			return err
+		}
+
+		entryPath := path + "!/" + name
+		if isArchive(name) && depth < *archiveDepth {
+			nested, err := s.scan(entry, entryPath, depth+1)
+			findings = append(findings, nested...)
+			return err
+		}
+		if !isBinary(entry) {
+			findings = append(findings, scanContent(entry, entryPath, s.rules)...)
+		}
+		return nil
+	})
+
+	return findings, err
+}
+
+// read reads an archive entry into memory. Entries larger than maxArchiveSize are skipped,
+// and an error is returned once the archive expands to more than its budget.
+func (s *archiveScan) read(r io.Reader) ([]byte, error) {
+	limit := int64(*maxArchiveSize) << 20
+	if s.budget < limit {
+		limit = s.budget
+	}
+
+	entry, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	s.budget -= int64(len(entry))
+	if err != nil {
+		return nil, err
+	}
+	if s.budget < 0 {
+		return nil, fmt.Errorf("went over the size limit, the archive might be a zip bomb")
+	}
+	if int64(len(entry)) > limit {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// walkArchive calls visit with every regular file inside the archive, picking the format from its name
+func walkArchive(content []byte, name string, visit func(name string, r io.Reader) error) error {
+	lower := strings.ToLower(name)
+
+	if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".gz") {
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		if strings.HasSuffix(lower, ".gz") && !strings.HasSuffix(lower, ".tar.gz") {
+			base := filepath.Base(name)
+			return visit(base[:len(base)-len(".gz")], gz)
+		}
+		return walkTar(gz, visit)
+	}
+
+	if strings.HasSuffix(lower, ".tar") {
+		return walkTar(bytes.NewReader(content), visit)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+	if len(r.File) > maxArchiveFiles {
+		return fmt.Errorf("%d entries, more than the limit of %d", len(r.File), maxArchiveFiles)
+	}
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = visit(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(r io.Reader, visit func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for files := 0; ; files++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if files >= maxArchiveFiles {
+			return fmt.Errorf("more entries than the limit of %d", maxArchiveFiles)
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		err = visit(header.Name, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
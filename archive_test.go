@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testRuleSet matches tokens such as tok_abcd1234, which the built-in rules don't know about
+func testRuleSet(t *testing.T) *ruleSet {
+	r := rule{Name: "Test token", Pattern: `tok_[a-z0-9]{8}`, Keywords: []string{"tok_"}}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return newRuleSet([]rule{r})
+}
+
+type archiveFile struct {
+	name    string
+	content []byte
+}
+
+func makeZip(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// makeTarGz makes a tar.gz archive, in which a file whose name ends with @ is a symlink to its content
+func makeTarGz(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0600, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.name[len(f.name)-1] == '@' {
+			header = &tar.Header{Name: f.name[:len(f.name)-1], Typeflag: tar.TypeSymlink, Linkname: string(f.content)}
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func makeGz(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(content)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestScanArchive(t *testing.T) {
+	secret := []byte("TOKEN=tok_abcd1234\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		content []byte
+		depth   int
+		want    []string
+	}{
+		{"zip", "dist/app.zip",
+			makeZip(t, archiveFile{"config/app.env", secret}, archiveFile{"README", []byte("nothing")}),
+			3, []string{"dist/app.zip!/config/app.env"}},
+		{"jar in a tar.gz", "release.tar.gz",
+			makeTarGz(t, archiveFile{"lib/app.jar", makeZip(t, archiveFile{"app.properties", secret})}),
+			3, []string{"release.tar.gz!/lib/app.jar!/app.properties"}},
+		{"three levels", "a.zip",
+			makeZip(t, archiveFile{"b.tgz", makeTarGz(t, archiveFile{"c.zip", makeZip(t, archiveFile{"d.env", secret})})}),
+			3, []string{"a.zip!/b.tgz!/c.zip!/d.env"}},
+		{"nested deeper than archiveDepth", "a.zip",
+			makeZip(t, archiveFile{"b.zip", makeZip(t, archiveFile{"c.env", secret})}, archiveFile{"top.env", secret}),
+			1, []string{"a.zip!/top.env"}},
+		{"archiveDepth 0", "a.zip",
+			makeZip(t, archiveFile{"top.env", secret}),
+			0, nil},
+		{"gz of a single file", "backup/dump.sql.gz",
+			makeGz(t, secret),
+			3, []string{"backup/dump.sql.gz!/dump.sql"}},
+		{"binary entries are skipped", "a.zip",
+			makeZip(t, archiveFile{"bin", append([]byte{0, 1, 2}, secret...)}),
+			3, nil},
+		{"symlinks are skipped", "a.tar.gz",
+			makeTarGz(t, archiveFile{"link@", secret}, archiveFile{"real.env", secret}),
+			3, []string{"a.tar.gz!/real.env"}},
+		{"not an archive", "a.zip",
+			secret,
+			3, nil},
+	}
+
+	saved := *archiveDepth
+	defer func() { *archiveDepth = saved }()
+	rules := testRuleSet(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*archiveDepth = test.depth
+			var got []string
+			for _, finding := range scanArchive(test.content, test.path, rules) {
+				got = append(got, finding.Path)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("found secrets in %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScanArchiveBudget(t *testing.T) {
+	saved := *maxArchiveSize
+	defer func() { *maxArchiveSize = saved }()
+	*maxArchiveSize = 1
+
+	// an entry over maxArchiveSize is skipped, while the ones next to it are still scanned
+	large := bytes.Repeat([]byte("a"), 1<<20+1)
+	content := makeZip(t, archiveFile{"large.txt", large}, archiveFile{"small.env", []byte("tok_abcd1234")})
+	findings := scanArchive(content, "a.zip", testRuleSet(t))
+	if len(findings) != 1 || findings[0].Path != "a.zip!/small.env" {
+		t.Errorf("got %+v, want a finding in a.zip!/small.env", findings)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+// TestBuiltinRules runs the fixtures of every built-in rule, so a broken rule fails the build
+func TestBuiltinRules(t *testing.T) {
+	for _, builtin := range builtinRules {
+		r := builtin
+		t.Run(r.Name, func(t *testing.T) {
+			if len(r.Positives) == 0 || len(r.Negatives) == 0 {
+				t.Errorf("rule %s needs at least one positive and one negative example", r.Name)
+			}
+			for _, problem := range testRule(&r) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+func TestBuiltinRulesUnique(t *testing.T) {
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, r := range builtinRules {
+		if ids[r.ID] {
+			t.Errorf("rule id %q is used more than once", r.ID)
+		}
+		if names[r.Name] {
+			t.Errorf("rule name %q is used more than once", r.Name)
+		}
+		ids[r.ID] = true
+		names[r.Name] = true
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Documents are repository content that is not part of the git history, such as issues,
+// collected through the API into /tmp/documents/<owner>/<repo>/<source>/.
+// Each source is scanned by the native scanner into /tmp/results/<owner>/<repo>/<source>.
+const documentsDir = "/tmp/documents/"
+
+var documentSources = []string{"issues", "actions", "releases"}
+
+func documentDir(owner string, repo string, source string) string {
+	return documentsDir + owner + "/" + repo + "/" + source
+}
+
+func checkdocumentflags() error {
+	if *actionsRuns < 1 {
+		fmt.Println("actionsRuns should be at least 1")
+		os.Exit(2)
+	}
+	if *maxDownloadSize < 1 {
+		fmt.Println("maxDownloadSize should be at least 1 MB")
+		os.Exit(2)
+	}
+	return nil
+}
+
+// collector downloads one source of documents of a repo into the documents workspace
+type collector func(ctx context.Context, client *github.Client, owner string, repo string) error
+
+// collectdocuments downloads one source of documents of a repo, and queues them to be scanned unless downloadOnly is used
+func collectdocuments(ctx context.Context, client *github.Client, owner string, repo string, source string, collect collector) {
+	if journal.has(owner+"/"+repo, stepCollected, source) {
+		fmt.Println("Skipping the " + source + " of " + owner + "/" + repo + " as they were collected before the run was interrupted")
+		return
+	}
+
+	if !workspace.reserve() {
+		fmt.Println("Skipping the " + source + " of " + owner + "/" + repo + " as the clones and documents on disk use up maxDiskUsage")
+		summary.skip(owner+"/"+repo+" "+source, "maxDiskUsage reached")
+		return
+	}
+
+	err := collect(ctx, client, owner, repo)
+	if err != nil {
+		fmt.Println("Collecting the " + source + " of " + owner + "/" + repo + " failed: " + fmt.Sprint(err))
+		return
+	}
+	if *downloadOnly {
+		journal.record(owner+"/"+repo, stepCollected, source)
+		return
+	}
+	workspace.added(documentDir(owner, repo, source))
+	queueDocumentScan(owner, repo, source)
+}
+
+// queueDocumentScan scans one source of documents of a repo in the scan pool, next to the clones.
+// The documents are deleted once scanned like the clones are, and only then recorded as collected,
+// so an interrupted run collects them again rather than leaving them unscanned.
+func queueDocumentScan(owner string, repo string, source string) {
+	scanPool.submit(owner+"/"+repo+" "+source, func(ctx context.Context) {
+		err := scanDocumentSource(owner, repo, source)
+		if err != nil {
+			Info("Scanning the " + source + " of " + owner + "_" + repo + " failed. Please scan it manually.")
+			fmt.Println(err)
+		} else {
+			journal.record(owner+"/"+repo, stepCollected, source)
+		}
+
+		// like the clones, the documents are deleted even when the scan fails
+		if clonesDisposable() {
+			dir := documentDir(owner, repo, source)
+			err = os.RemoveAll(dir)
+			workspace.removed(dir, err == nil)
+		}
+	})
+}
+
+func writeDocument(path string, content string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(content), 0600)
+}
+
+// noRedirectClient stops at the redirects that file downloads answer with,
+// so the API token is not sent along to the storage host they point to
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// downloadAPIFile downloads a file served by the API, such as a log or an artifact archive, to dest.
+// It refuses files larger than maxBytes.
+func downloadAPIFile(ctx context.Context, client *github.Client, urlStr string, accept string, dest string, maxBytes int64) error {
+	req, err := client.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", "token "+*token)
+
+	resp, err := noRedirectClient.Do(req.WithContext(ctx))
+	summary.apiCall(resp)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusFound || resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusTemporaryRedirect {
+		redirect, err := http.NewRequest("GET", resp.Header.Get("Location"), nil)
+		if err != nil {
+			return err
+		}
+		resp, err = http.DefaultClient.Do(redirect.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s failed: %s", urlStr, resp.Status)
+	}
+	if resp.ContentLength > maxBytes {
+		return fmt.Errorf("%s is %d bytes, larger than the download size limit", urlStr, resp.ContentLength)
+	}
+
+	_, err = writeLimited(dest, resp.Body, maxBytes)
+	return err
+}
+
+// scanDocuments queues the documents left on disk by an earlier run to be scanned, for scanOnly
+func scanDocuments() {
+	owners, _ := ioutil.ReadDir(documentsDir)
+	for _, owner := range owners {
+		repos, _ := ioutil.ReadDir(documentsDir + owner.Name())
+		for _, repo := range repos {
+			for _, source := range documentSources {
+				if fileExists(documentDir(owner.Name(), repo.Name(), source)) {
+					queueDocumentScan(owner.Name(), repo.Name(), source)
+				}
+			}
+		}
+	}
+}
+
+func scanDocumentSource(owner string, repo string, source string) error {
+	rules, err := nativeRuleSet()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	findings, err := scanTree(documentDir(owner, repo, source), documentsDir+owner+"/"+repo, rules)
+	summary.toolRan(source, time.Since(start))
+	if err != nil {
+		return err
+	}
+
+	outputDir := "/tmp/results/" + owner + "/" + repo
+	os.MkdirAll(outputDir, 0700)
+	if *verify {
+		findings = verifyFindings(findings)
+	}
+	err = writeNativeOutput(findings, outputDir+"/"+source)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Finished scanning the " + source + " of: " + owner + "_" + repo)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha512"
+	"math/big"
+)
+
+// The public key of an ed25519 seed, for the PKCS8 keys that don't hold it. Go only has ed25519 since
+// 1.13, so this is the RFC 8032 derivation with math/big. It is neither fast nor constant time,
+// which is fine for fingerprinting keys that were leaked already.
+
+var (
+	ed25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	ed25519D = bigFromString("37095705934669439343138083508754565189542113879843219016388785533085940283555")
+	ed25519B = edwardsPoint{
+		x: bigFromString("15112221349535400772501151409588531511454012693041857206046113283949847762202"),
+		y: bigFromString("46316835694926478169428394003475163141307993866256225615783033603165251855960"),
+	}
+)
+
+func bigFromString(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
+// edwardsPoint is a point of the ed25519 curve, -x² + y² = 1 + d x² y², in affine coordinates
+type edwardsPoint struct {
+	x, y *big.Int
+}
+
+func (a edwardsPoint) add(b edwardsPoint) edwardsPoint {
+	p := ed25519P
+	xx := new(big.Int).Mul(a.x, b.x)
+	yy := new(big.Int).Mul(a.y, b.y)
+	dxxyy := new(big.Int).Mul(ed25519D, xx)
+	dxxyy.Mul(dxxyy, yy).Mod(dxxyy, p)
+
+	// x = (x1 y2 + y1 x2) / (1 + d x1 x2 y1 y2)
+	x := new(big.Int).Mul(a.x, b.y)
+	x.Add(x, new(big.Int).Mul(a.y, b.x))
+	denominator := new(big.Int).Add(big.NewInt(1), dxxyy)
+	x.Mul(x, denominator.ModInverse(denominator, p)).Mod(x, p)
+
+	// y = (y1 y2 + x1 x2) / (1 - d x1 x2 y1 y2)
+	y := new(big.Int).Add(yy, xx)
+	denominator = new(big.Int).Sub(big.NewInt(1), dxxyy)
+	denominator.Mod(denominator, p)
+	y.Mul(y, denominator.ModInverse(denominator, p)).Mod(y, p)
+	return edwardsPoint{x, y}
+}
+
+// ed25519PublicKey derives the public key of a 32 byte seed: the base point multiplied by the
+// clamped first half of the seed's SHA512, encoded as y in little endian with the sign of x on top
+func ed25519PublicKey(seed []byte) []byte {
+	h := sha512.Sum512(seed)
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+	scalar := new(big.Int).SetBytes(reverse(h[:32]))
+
+	sum := edwardsPoint{big.NewInt(0), big.NewInt(1)}
+	for i := scalar.BitLen() - 1; i >= 0; i-- {
+		sum = sum.add(sum)
+		if scalar.Bit(i) == 1 {
+			sum = sum.add(ed25519B)
+		}
+	}
+
+	public := make([]byte, 32)
+	y := sum.y.Bytes()
+	copy(public[32-len(y):], y)
+	public = reverse(public)
+	public[31] |= byte(sum.x.Bit(0) << 7)
+	return public
+}
+
+// reverse returns a reversed copy of b, to go between little and big endian
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Results are as sensitive as the secrets in them, so the reports and the per-repo results can
+// be encrypted with a public key once the run is over, using the age or gpg tools, and the
+// plaintext files are overwritten before being removed.
+
+const resultsDir = "/tmp/results/"
+
+// encryptionTool tells from the public key file which tool encrypts with it: age recipients
+// start with age1 or are SSH public keys, anything else is taken as an OpenPGP key
+func encryptionTool(keyFile string) (string, error) {
+	content, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "age1") || strings.HasPrefix(line, "ssh-") {
+			return "age", nil
+		}
+		break
+	}
+	return "gpg", nil
+}
+
+func checkencryptflags() error {
+	if *encryptKey == "" {
+		return nil
+	}
+	tool, err := encryptionTool(*encryptKey)
+	if err != nil {
+		fmt.Println("Can't read the encryptKey file: " + fmt.Sprint(err))
+		os.Exit(2)
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		fmt.Println("encryptKey needs the " + tool + " tool to be installed")
+		os.Exit(2)
+	}
+	return nil
+}
+
+// encryptFile encrypts path to path.age or path.gpg and shreds the plaintext
+func encryptFile(path string, tool string) error {
+
+	var cmd *exec.Cmd
+	if tool == "age" {
+		cmd = exec.Command("age", "-R", *encryptKey, "-o", path+".age", path)
+	} else {
+		cmd = exec.Command("gpg", "--batch", "--yes", "--trust-model", "always", "--recipient-file", *encryptKey,
+			"--output", path+".gpg", "--encrypt", path)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("encrypting %s failed: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return shredFile(path)
+}
+
+// shredFile overwrites a file with random bytes before removing it. On copy on write
+// filesystems and SSDs the old blocks may survive, so this is only a best effort.
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// walkResults calls visit with every per-repo results file, along with the downloaded documents
+func walkResults(visit func(path string) error) error {
+	for _, dir := range []string{resultsDir, documentsDir} {
+		if !fileExists(dir) {
+			continue
+		}
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			return visit(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptResults encrypts the output files and whatever per-repo results are left
+func encryptResults(outputs []string) error {
+	tool, err := encryptionTool(*encryptKey)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		if !fileExists(output) {
+			continue
+		}
+		err := encryptFile(output, tool)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Encrypted " + output + " into " + output + "." + tool)
+	}
+	return walkResults(func(path string) error {
+		if strings.HasSuffix(path, ".age") || strings.HasSuffix(path, ".gpg") {
+			return nil
+		}
+		return encryptFile(path, tool)
+	})
+}
+
+// shredIntermediates shreds the per-repo results and documents, which are no longer needed once merged
+func shredIntermediates() error {
+	err := walkResults(shredFile)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(resultsDir)
+	os.RemoveAll(documentsDir)
+	return nil
+}
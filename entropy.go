@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, c := range s {
+		counts[c]++
+		total++
+	}
+
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// entropyRule is what the native scanner reports high entropy strings under,
+// the same name truffleHog uses for them
+var entropyRule = rule{ID: "high-entropy", Name: "High Entropy", Severity: "low", Confidence: "low"}
+
+// keyAssignment matches the end of the text before a string assigned to a key-like identifier,
+// like `aws_secret = "`, `"apiKey": "` or `TOKEN := `
+var keyAssignment = regexp.MustCompile(`(?i)(?:key|secret|token|pass(?:word|wd)?|pwd|credential|auth|api|private|signature|salt|cert)[a-z0-9_.\-]*["'\]]?\s*(?::=|=>|=|:)\s*[@"'\x60]?$`)
+
+// entropyDetector finds random looking strings, which are likely secrets no rule describes.
+// Strings of hex digits are held to their own threshold, as they can't reach the entropy of base64.
+type entropyDetector struct {
+	base64    float64
+	hex       float64
+	minLength int
+	context   bool
+}
+
+func newEntropyDetector() *entropyDetector {
+	return &entropyDetector{base64: *entropyBase64, hex: *entropyHex, minLength: *entropyMinLength, context: *entropyContext}
+}
+
+func isBase64Char(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '+' || c == '/' || c == '=' || c == '_' || c == '-'
+}
+
+// find returns the strings of the line over the threshold of their charset
+func (d *entropyDetector) find(line string) []string {
+	var found []string
+	if len(line) < d.minLength {
+		return nil
+	}
+
+	for start := 0; start < len(line); {
+		if !isBase64Char(line[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(line) && isBase64Char(line[end]) {
+			end++
+		}
+		word := line[start:end]
+		if len(word) >= d.minLength && d.random(word) && (!d.context || keyAssignment.MatchString(line[:start])) {
+			found = append(found, word)
+		}
+		start = end
+	}
+	return found
+}
+
+// random reports whether a word is over the entropy threshold of its charset. Words need both
+// letters and digits, which rules out identifiers, long numbers and paths.
+func (d *entropyDetector) random(word string) bool {
+	if !strings.ContainsAny(word, "0123456789") || strings.Trim(word, "0123456789+/=_-") == "" {
+		return false
+	}
+	if strings.Trim(word, "0123456789abcdefABCDEF") == "" {
+		return shannonEntropy(word) >= d.hex
+	}
+	return shannonEntropy(word) >= d.base64
+}
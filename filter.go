@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const dateFlagLayout = "2006-01-02"
+
+// pushedSinceDate is pushedSince parsed by checkfilterflags
+var pushedSinceDate time.Time
+
+func checkfilterflags() error {
+	if *maxRepoSize < 0 {
+		fmt.Println("maxRepoSize can't be negative. Please provide a size in MB or leave it at 0 for no limit")
+		os.Exit(2)
+	}
+	if *pushedSince != "" {
+		date, err := time.Parse(dateFlagLayout, *pushedSince)
+		if err != nil {
+			fmt.Println("pushedSince should be a date in the format YYYY-MM-DD. Example: 2017-01-01")
+			os.Exit(2)
+		}
+		pushedSinceDate = date
+	}
+	return nil
+}
+
+// splitFlagList splits a comma seperated flag value into its trimmed, non-empty items
+func splitFlagList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRepo evaluates the repo metadata returned by the listing calls against the filter flags.
+// It returns the reason the repo should be skipped, or an empty string if it should be cloned.
+func filterRepo(repo *github.Repository) string {
+	if !*cloneForks && repo.GetFork() {
+		return "fork"
+	}
+
+	if *skipArchived && repo.GetArchived() {
+		return "archived"
+	}
+
+	if langs := splitFlagList(*languages); len(langs) > 0 && !containsFold(langs, repo.GetLanguage()) {
+		language := repo.GetLanguage()
+		if language == "" {
+			language = "unknown"
+		}
+		return "language " + language + " not in " + strings.Join(langs, ",")
+	}
+
+	// Size is reported by the API in KB
+	if *maxRepoSize > 0 && repo.GetSize() > *maxRepoSize*1024 {
+		return "size " + strconv.Itoa(repo.GetSize()/1024) + "MB larger than " + strconv.Itoa(*maxRepoSize) + "MB"
+	}
+
+	if *pushedSince != "" {
+		// empty repos have no push date
+		if repo.PushedAt == nil {
+			return "never pushed to"
+		}
+		if pushedAt := repo.GetPushedAt(); pushedAt.Before(pushedSinceDate) {
+			return "last pushed " + pushedAt.Format(dateFlagLayout) + ", before " + *pushedSince
+		}
+	}
+
+	if wanted := splitFlagList(*topics); len(wanted) > 0 {
+		tagged := false
+		for _, topic := range repo.Topics {
+			if containsFold(wanted, topic) {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			return "not tagged with any of the topics " + strings.Join(wanted, ",")
+		}
+	}
+
+	return ""
+}
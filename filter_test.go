@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestFilterRepo(t *testing.T) {
+	saved := *pushedSince
+	defer func() { *pushedSince = saved }()
+	*pushedSince = "2018-01-01"
+	pushedSinceDate = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pushed := func(date string) *github.Timestamp {
+		at, _ := time.Parse(dateFlagLayout, date)
+		return &github.Timestamp{Time: at}
+	}
+	tests := []struct {
+		name string
+		repo *github.Repository
+		want string
+	}{
+		{"pushed after", &github.Repository{PushedAt: pushed("2018-06-01")}, ""},
+		{"pushed on the date", &github.Repository{PushedAt: pushed("2018-01-01")}, ""},
+		{"pushed before", &github.Repository{PushedAt: pushed("2017-12-31")}, "last pushed 2017-12-31, before 2018-01-01"},
+		{"never pushed to", &github.Repository{}, "never pushed to"},
+	}
+
+	for _, test := range tests {
+		if got := filterRepo(test.repo); got != test.want {
+			t.Errorf("%s: filterRepo = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 )
@@ -20,17 +21,57 @@ var (
 	gistURL              = flag.String("gistURL", "", "HTTPS URL of the Github gist to scan. Example: https://gist.github.com/secretuser1/81963f276280d484767f9be895316afc")
 	cloneForks           = flag.Bool("cloneForks", false, "Option to clone org and user repos that are forks. Default is false")
 	orgOnly              = flag.Bool("orgOnly", false, "Option to skip cloning user repo's when scanning an org. Default is false")
-	toolName             = flag.String("toolName", "all", "Specify whether to run thog or repo-supervisor")
+	toolName             = flag.String("toolName", "all", "Specify whether to run thog, repo-supervisor or native")
 	teamName             = flag.String("teamName", "", "Name of the Organization Team which has access to private repositories for scanning.")
 	scanPrivateReposOnly = flag.Bool("scanPrivateReposOnly", false, "Option to scan private repositories only. Default is false")
 	enterpriseURL        = flag.String("enterpriseURL", "", "Base URL of the Github Enterprise")
 	threads              = flag.Int("threads", 10, "Amount of parallel threads")
+	apiThreads           = flag.Int("apiThreads", 0, "Amount of parallel downloads through the API. Default is 0 i.e. threads")
+	cloneThreads         = flag.Int("cloneThreads", 0, "Amount of parallel clones. Default is 0 i.e. threads")
+	scanThreads          = flag.Int("scanThreads", 0, "Amount of parallel scans. Default is 0 i.e. threads")
+	cloneTimeout         = flag.Duration("cloneTimeout", time.Hour, "Time after which the clone of a repo is given up on. 0 means no timeout")
+	cloneRetries         = flag.Int("cloneRetries", 3, "Number of times a clone failing on the network or on the server is retried")
+	scanTimeout          = flag.Duration("scanTimeout", 2*time.Hour, "Time after which each tool scanning a repo is given up on. 0 means no timeout")
+	apiTimeout           = flag.Duration("apiTimeout", 15*time.Minute, "Time after which a download through the API, such as the issues or the workflow runs of a repo, is given up on")
 	thogEntropy          = flag.Bool("thogEntropy", false, "Option to include high entropy secrets when truffleHog is used")
 	mergeOutput          = flag.Bool("mergeOutput", false, "Merge the output files of all the tools used into one JSON file")
+	redact               = flag.Bool("redact", true, "Mask the secrets in the output file to their first and last characters, keeping their fingerprints. Use -redact=false for the full secrets")
+	incidentsOutput      = flag.String("incidentsOutput", "incidents.json", "Output file to save the secret incidents to when mergeOutput is used, grouping the findings of each distinct secret")
+	summaryOutput        = flag.String("summaryOutput", "", "Output file to save the run summary to as JSON, with the counts of repos, commits and findings, the durations of the tools and the API calls made. Default is none")
+	fingerprintSalt      = flag.String("fingerprintSalt", "", "Salt of the secret fingerprints. Use the same salt to compare fingerprints across runs. Default is a random salt")
+	encryptKey           = flag.String("encryptKey", "", "Path to an age recipients file or an OpenPGP public key to encrypt the output files and the per-repo results with")
+	shredResults         = flag.Bool("shredResults", false, "Overwrite and delete the per-repo results and documents once they are merged into the output file. Default is false")
+	resume               = flag.Bool("resume", false, "Option to pick up an interrupted run where it left off, skipping the repos it cloned and scanned. Default is false")
+	keepClones           = flag.Bool("keepClones", false, "Option to keep the repos cloned once they are scanned instead of deleting them. Default is false")
+	maxDiskUsage         = flag.Int("maxDiskUsage", 0, "Hold back cloning and collecting documents while the repos and documents on disk use more than this size in MB. Default is 0 i.e. no limit")
 	blacklist            = flag.String("blacklist", "", "Comma seperated values of Repos to Skip Scanning for")
-	executionQueue       chan bool
 	scanOnly             = flag.Bool("scanOnly", false, "Just scan, do not download. Please make sure to mount a volume with correct file structure.")   //TODO improve docs about this
 	downloadOnly         = flag.Bool("downloadOnly", false, "Just download, do not scan. Please make sure to mount a volume to retain downloaded data.") //TODO improve docs about this
+	skipArchived         = flag.Bool("skipArchived", false, "Option to skip org and user repos that are archived. Default is false")
+	languages            = flag.String("languages", "", "Comma seperated values of primary languages. Only repos written in one of these languages are cloned. Example: Go,Python")
+	topics               = flag.String("topics", "", "Comma seperated values of topics. Only repos tagged with at least one of these topics are cloned. Example: production,payments")
+	maxRepoSize          = flag.Int("maxRepoSize", 0, "Skip repos larger than this size in MB. Default is 0 i.e. no limit")
+	pushedSince          = flag.String("pushedSince", "", "Skip repos that have not been pushed to since this date. Format is YYYY-MM-DD. Example: 2017-01-01")
+	since                = flag.String("since", "", "Only clone and scan the history since this date. Format is YYYY-MM-DD. Example: 2018-06-01")
+	depth                = flag.Int("depth", 0, "Only clone and scan the last n commits. Default is 0 i.e. full history")
+	allRefs              = flag.Bool("allRefs", false, "Option to fetch and scan all branches, tags and pull request refs instead of just the default branch. Default is false")
+	scanWikis            = flag.Bool("scanWikis", false, "Option to also clone and scan the wiki of org and user repos that have one. Default is false")
+	scanIssues           = flag.Bool("scanIssues", false, "Option to also scan the issues, pull requests, comments and reviews of org and user repos. Default is false")
+	scanActions          = flag.Bool("scanActions", false, "Option to also scan the logs and artifacts of the recent Github Actions workflow runs of org and user repos. Default is false")
+	actionsRuns          = flag.Int("actionsRuns", 10, "Number of recent workflow runs per repo to scan when scanActions is used")
+	scanReleases         = flag.Bool("scanReleases", false, "Option to also scan the notes, assets and source archives of the releases of org and user repos. Default is false")
+	maxDownloadSize      = flag.Int("maxDownloadSize", 10, "Skip logs, artifacts and other files downloaded through the API that are larger than this size in MB")
+	rulesFile            = flag.String("rules", "/root/truffleHog/rules.json", "Path to the rules.json file with the regular expressions to scan for")
+	nativeEntropy        = flag.Bool("nativeEntropy", false, "Option to have the native scanner also report high entropy strings. Default is false")
+	entropyBase64        = flag.Float64("entropyBase64", 4.0, "Entropy in bits per character above which the native scanner reports a base64 string")
+	entropyHex           = flag.Float64("entropyHex", 3.0, "Entropy in bits per character above which the native scanner reports a hex string")
+	entropyMinLength     = flag.Int("entropyMinLength", 20, "Shortest string the native scanner checks the entropy of")
+	entropyContext       = flag.Bool("entropyContext", true, "Only report high entropy strings assigned to a key-like identifier, such as secret, token or password. Default is true")
+	ruleSource           = flag.String("ruleSource", "both", "Which rules to scan with: builtin, file or both. With both, rules in the rules file replace the built-in rules with the same id or name")
+	verify               = flag.Bool("verify", false, "Option to check whether the secrets found by rules with a verifier are live, by calling the API they belong to. Default is false")
+	verifyBaseURL        = flag.String("verifyBaseURL", "", "Base URL to send all the verification requests to instead of the real APIs, such as a local mock server")
+	archiveDepth         = flag.Int("archiveDepth", 3, "How many levels of nested archives the native scanner opens, such as a jar inside a zip. 0 means archives are not opened")
+	maxArchiveSize       = flag.Int("maxArchiveSize", 50, "Skip archives, and files inside archives, that are larger than this size in MB when scanning with native")
 )
 
 func stringInSlice(a string, list []*github.Repository) (bool, error) {
@@ -56,6 +97,22 @@ func checkifsshkeyexists() error {
 	return nil
 }
 
+func checkhistoryflags() error {
+	if *depth < 0 {
+		fmt.Println("depth can't be negative. Please provide a number of commits or leave it at 0 for the full history")
+		os.Exit(2)
+	} else if *since != "" && *depth > 0 {
+		fmt.Println("Can't have since along with depth. Please provide just one of these values")
+		os.Exit(2)
+	} else if *since != "" {
+		if _, err := time.Parse(dateFlagLayout, *since); err != nil {
+			fmt.Println("since should be a date in the format YYYY-MM-DD. Example: 2018-06-01")
+			os.Exit(2)
+		}
+	}
+	return nil
+}
+
 func checkflags(token string, org string, user string, repoURL string, gistURL string, teamName string, scanPrivateReposOnly bool, orgOnly bool, toolName string, enterpriseURL string, thogEntropy bool) error {
 	if token == "" {
 		fmt.Println("Need a Github personal access token. Please provide that using the -token flag")
@@ -196,8 +253,8 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 	} else if scanPrivateReposOnly && gistURL != "" {
 		fmt.Println("scanPrivateReposOnly flag should NOT be provided with the gistURL since its a private repository or multiple private repositories that we are looking to scan. Please provide either a user, an org or a private repoURL")
 		os.Exit(2)
-	} else if !(toolName == "thog" || toolName == "repo-supervisor" || toolName == "all") {
-		fmt.Println("Please enter either thog or repo-supervisor. Default is all.")
+	} else if !(toolName == "thog" || toolName == "repo-supervisor" || toolName == "native" || toolName == "all") {
+		fmt.Println("Please enter either thog, repo-supervisor or native. Default is all.")
 		os.Exit(2)
 	} else if repoURL != "" && !scanPrivateReposOnly && enterpriseURL == "" {
 		if strings.Split(repoURL, "@")[0] == "git" {
@@ -4,32 +4,230 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
 
-func gitclone(cloneURL string, repoName string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// gitclone clones a repo, waiting for room on disk first when maxDiskUsage is used.
+// Clones failing on the network or on the server are retried cloneRetries times.
+// The clone is given up on after cloneTimeout, retries and fetching all the refs included.
+func gitclone(ctx context.Context, cloneURL string, repoName string, wiki bool) error {
+	if !workspace.reserve() {
+		fmt.Println("Skipping " + cloneURL + " as the clones and documents on disk use up maxDiskUsage")
+		summary.skip(cloneURL, "maxDiskUsage reached")
+		return fmt.Errorf("maxDiskUsage reached")
+	}
+
+	ctx, cancel := withTimeout(ctx, *cloneTimeout)
+	defer cancel()
+
+	params := []string{"clone"}
+	if *since != "" {
+		params = append(params, "--shallow-since="+*since)
+	} else if *depth > 0 {
+		params = append(params, "--depth="+strconv.Itoa(*depth))
+	}
+	params = append(params, cloneURL, repoName)
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		cmd := exec.CommandContext(ctx, "/usr/bin/git", params...)
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		err = runCommand(ctx, cmd)
+		if err == nil || err == context.Canceled {
+			break
+		}
+		// git doesn't get to clean up after itself when it is killed
+		os.RemoveAll(repoName)
+		if err == context.DeadlineExceeded {
+			fmt.Println("Cloning " + cloneURL + " timed out after " + cloneTimeout.String())
+			summary.timeout(cloneURL, "clone", *cloneTimeout)
+			return err
+		}
+
+		class := classifyCloneError(stderr.String())
+		if class == cloneErrorNoCommits {
+			fmt.Println("Skipping " + cloneURL + " as it has no commits since " + *since)
+			summary.skip(cloneURL, "no commits since "+*since)
+			return err
+		}
+		if class == cloneErrorNotFound && wiki {
+			// Github says every repo has a wiki until it is turned off, the wiki repo only exists once a page is written
+			fmt.Println("Skipping " + cloneURL + " as the repo has no wiki pages")
+			return err
+		}
+		if !retryableCloneError(class) || attempt >= *cloneRetries {
+			fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
+			summary.notCloned(cloneURL, class, gitError(stderr.String()))
+			return err
+		}
+		delay := cloneRetryDelay << uint(attempt)
+		fmt.Printf("Cloning %s failed (%s error), retrying in %s: %s\n", cloneURL, class, delay, gitError(stderr.String()))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				summary.timeout(cloneURL, "clone", *cloneTimeout)
+			}
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if *allRefs {
+		err = gitfetchallrefs(ctx, repoName)
+		if err == context.DeadlineExceeded {
+			fmt.Println("Fetching all refs of " + cloneURL + " timed out after " + cloneTimeout.String() + ", only the default branch is scanned")
+			summary.timeout(cloneURL, "fetching all refs", *cloneTimeout)
+		} else if err != nil {
+			fmt.Println("Fetching all refs failed for " + cloneURL + ": " + fmt.Sprint(err))
+		}
+	}
+	workspace.added(repoName)
+	return nil
+}
 
-	cmd := exec.Command("/usr/bin/git", "clone", cloneURL, repoName)
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out
+// cloneRetryDelay is how long the first retry of a clone waits, each retry waiting twice as long
+const cloneRetryDelay = 5 * time.Second
+
+// Classes of clone errors. git exits with 128 for all of them, so they are told apart by its output.
+const (
+	cloneErrorNoCommits = "no commits"
+	cloneErrorAuth      = "auth"
+	cloneErrorNotFound  = "not found"
+	cloneErrorServer    = "server"
+	cloneErrorNetwork   = "network"
+	cloneErrorOther     = "other"
+)
+
+// cloneErrors are checked in order, as a 502 is also reported as an RPC failure
+var cloneErrors = []struct {
+	class   string
+	pattern *regexp.Regexp
+}{
+	// a repo with no commits since the since date has nothing to scan, git just reports it as an error
+	{cloneErrorNoCommits, regexp.MustCompile(`(?i)no commits selected for shallow requests`)},
+	{cloneErrorAuth, regexp.MustCompile(`(?i)authentication failed|could not read (username|password)|terminal prompts disabled|permission denied|host key verification failed|returned error: 40[13]`)},
+	{cloneErrorNotFound, regexp.MustCompile(`(?i)repository .*not found|does not appear to be a git repository|returned error: 404`)},
+	{cloneErrorServer, regexp.MustCompile(`(?i)returned error: 5\d\d|HTTP 5\d\d|internal server error|service unavailable|bad gateway`)},
+	{cloneErrorNetwork, regexp.MustCompile(`(?i)could not resolve|connection (timed out|reset|refused|closed|was reset)|operation timed out|failed to connect|network is unreachable|early eof|rpc failed|unexpected disconnect|transfer closed|broken pipe|gnutls_handshake|gnutls recv error|ssl_error_syscall`)},
+}
+
+// remoteHungUp is how git ends its output whatever went wrong on the other end
+var remoteHungUp = regexp.MustCompile(`(?i)remote end hung up`)
+
+// classifyCloneError tells from the output of git clone why it failed
+func classifyCloneError(stderr string) string {
+	for _, e := range cloneErrors {
+		if e.pattern.MatchString(stderr) {
+			return e.class
+		}
+	}
+	// the connection dropping is only the reason when git has nothing more specific to say
+	if remoteHungUp.MatchString(gitError(stderr)) {
+		return cloneErrorNetwork
+	}
+	return cloneErrorOther
+}
+
+// retryableCloneError tells whether a clone might work on a retry. Auth and missing repos won't get any better.
+func retryableCloneError(class string) bool {
+	return class == cloneErrorNetwork || class == cloneErrorServer
+}
+
+// gitError returns the line of the output of git saying what went wrong, which is the first fatal one
+func gitError(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "fatal: ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "fatal: "))
+		}
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// allRefsPrefix is the local branch namespace that pull request heads and tags are mirrored into.
+// truffleHog only walks branches, so they have to be branches for it to see them.
+const allRefsPrefix = "refs/heads/all-refs/"
+
+func gitfetchallrefs(ctx context.Context, path string) error {
+	params := []string{"-C", path, "fetch", "--quiet", "--update-head-ok"}
+	if *since != "" {
+		params = append(params, "--shallow-since="+*since)
+	} else if *depth > 0 {
+		params = append(params, "--depth="+strconv.Itoa(*depth))
+	}
+	params = append(params, "origin",
+		"+refs/heads/*:refs/heads/*",
+		"+refs/tags/*:refs/tags/*",
+		"+refs/pull/*/head:"+allRefsPrefix+"pull/*")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/usr/bin/git", params...)
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	if err := runCommand(ctx, cmd); err == context.DeadlineExceeded {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr.String())
+	}
+
+	out, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "for-each-ref", "--format=%(refname)", "refs/tags"))
+	if err != nil {
+		return err
+	}
+	for _, tag := range strings.Fields(string(out)) {
+		// tags can point to trees and blobs, those are not walked by anyone
+		commit, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "rev-parse", "--verify", "--quiet", tag+"^{commit}"))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			continue
+		}
+		branch := allRefsPrefix + "tags/" + strings.TrimPrefix(tag, "refs/tags/")
+		err = runCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "update-ref", branch, strings.TrimSpace(string(commit))))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitRefsContaining lists the refs of the repo a commit is reachable from.
+// Mirrored pull request heads and tags are reported under their original names.
+func gitRefsContaining(ctx context.Context, path string, commit string) ([]string, error) {
+	out, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "for-each-ref", "--contains", commit, "--format=%(refname)", "refs/heads"))
 	if err != nil {
-		fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-		// panic(err)
+		return nil, err
 	}
+
+	var refs []string
+	for _, ref := range strings.Fields(string(out)) {
+		if !strings.HasPrefix(ref, allRefsPrefix) {
+			refs = append(refs, ref)
+		} else if pr := strings.TrimPrefix(ref, allRefsPrefix+"pull/"); pr != ref {
+			refs = append(refs, "refs/pull/"+pr+"/head")
+		} else {
+			refs = append(refs, "refs/tags/"+strings.TrimPrefix(ref, allRefsPrefix+"tags/"))
+		}
+	}
+	return refs, nil
 }
 
-func gitRepoURL(path string) (string, error) {
-	out, err := exec.Command("/usr/bin/git", "-C", path, "config", "--get", "remote.origin.url").Output()
+func gitRepoURL(ctx context.Context, path string) (string, error) {
+	out, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "config", "--get", "remote.origin.url"))
 	if err != nil {
 		return "", err
 	}
@@ -37,8 +235,46 @@ func gitRepoURL(path string) (string, error) {
 	return url, nil
 }
 
-// Moving cloning logic out of individual functions
-func executeclone(repo *github.Repository, directory string, wg *sync.WaitGroup) {
+const wikiSuffix = ".wiki"
+
+// wikiParent returns the name of the repo a wiki clone belongs to,
+// or an empty string if the clone is not a wiki
+func wikiParent(name string) string {
+	if strings.HasSuffix(name, wikiSuffix) {
+		return strings.TrimSuffix(name, wikiSuffix)
+	}
+	return ""
+}
+
+// gitCommitCount counts the commits of a repo reachable from any ref, restricted to the since or depth window
+// like the native scanner. It is 0 for directories that are not git repos.
+func gitCommitCount(ctx context.Context, path string) int {
+	params := []string{"-C", path, "rev-list", "--count", "--all"}
+	if *since != "" {
+		params = append(params, "--since="+*since)
+	} else if *depth > 0 {
+		params = append(params, "--max-count="+strconv.Itoa(*depth))
+	}
+	out, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", params...))
+	if err != nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+	return count
+}
+
+// gitSinceCommit returns the newest commit of the repo made before the since date.
+// It is empty when the history before that date was never cloned, as is the case for --shallow-since clones.
+func gitSinceCommit(ctx context.Context, path string, date string) string {
+	out, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", path, "rev-list", "-1", "--before="+date, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// executeclone queues a repo to be cloned along with its wiki, and the downloads of its documents
+func executeclone(ctx context.Context, client *github.Client, repo *github.Repository, directory string, owner string, p *pipeline) {
 	urlToClone := ""
 
 	switch *scanPrivateReposOnly {
@@ -54,25 +290,40 @@ func executeclone(repo *github.Repository, directory string, wg *sync.WaitGroup)
 		urlToClone = *repo.SSHURL
 	}
 
-	var orgclone sync.WaitGroup
-	if !*cloneForks && *repo.Fork {
-		fmt.Println(*repo.Name + " is a fork and the cloneFork flag was set to false so moving on..")
-	} else {
-		// clone it
-		orgclone.Add(1)
-		fmt.Println(urlToClone)
-		func(orgclone *sync.WaitGroup, urlToClone string, directory string) {
-			enqueueJob(func() {
-				gitclone(urlToClone, directory, orgclone)
-			})
-		}(&orgclone, urlToClone, directory)
-	}
-
-	orgclone.Wait()
-	wg.Done()
+	if reason := filterRepo(repo); reason != "" {
+		fmt.Println(*repo.Name + " is filtered out (" + reason + ") so moving on..")
+		summary.enumerated()
+		summary.skip(repo.GetFullName(), reason)
+		return
+	}
+
+	p.clone(urlToClone, directory, *repo.Name, owner)
+
+	if *scanWikis && repo.GetHasWiki() {
+		// the wiki is a separate repo, cloned next to the repo itself
+		wikiURL := strings.TrimSuffix(urlToClone, ".git") + wikiSuffix + ".git"
+		p.cloneWiki(wikiURL, directory+wikiSuffix, *repo.Name+wikiSuffix, owner)
+	}
+
+	repoOwner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	if *scanIssues {
+		p.collect(repoOwner+"/"+name+" issues", func(ctx context.Context) {
+			collectdocuments(ctx, client, repoOwner, name, "issues", collectissues)
+		})
+	}
+	if *scanActions {
+		p.collect(repoOwner+"/"+name+" actions", func(ctx context.Context) {
+			collectdocuments(ctx, client, repoOwner, name, "actions", collectactions)
+		})
+	}
+	if *scanReleases {
+		p.collect(repoOwner+"/"+name+" releases", func(ctx context.Context) {
+			collectdocuments(ctx, client, repoOwner, name, "releases", collectreleases)
+		})
+	}
 }
 
-func cloneorgrepos(ctx context.Context, client *github.Client, org string) error {
+func cloneorgrepos(ctx context.Context, client *github.Client, org string, p *pipeline) error {
 
 	Info("Cloning the repositories of the organization: " + org)
 	Info("If the token provided belongs to a user in this organization, this will also clone all public AND private repositories of this org, irrespecitve of the scanPrivateReposOnly flag being set..")
@@ -92,24 +343,22 @@ func cloneorgrepos(ctx context.Context, client *github.Client, org string) error
 		opt.Page = resp.NextPage
 	}
 
-	var orgrepowg sync.WaitGroup
-
 	//iterating through the repo array
 	for _, repo := range orgRepos {
 		if strings.Contains(*blacklist, *repo.Name) {
 			fmt.Println("Repo " + *repo.Name + " is in the repo blacklist, moving on..")
+			summary.enumerated()
+			summary.skip(repo.GetFullName(), "blacklisted")
 		} else {
-			orgrepowg.Add(1)
-			go executeclone(repo, "/tmp/repos/org/"+org+"/"+*repo.Name, &orgrepowg)
+			executeclone(ctx, client, repo, "/tmp/repos/org/"+org+"/"+*repo.Name, org, p)
 		}
 	}
 
-	orgrepowg.Wait()
-	fmt.Println("Done cloning org repos.")
+	fmt.Println("Done queueing org repos.")
 	return nil
 }
 
-func cloneuserrepos(ctx context.Context, client *github.Client, user string) error {
+func cloneuserrepos(ctx context.Context, client *github.Client, user string, p *pipeline) error {
 	Info("Cloning " + user + "'s repositories")
 	Info("If the scanPrivateReposOnly flag is set, this will only scan the private repositories of this user. If that flag is not set, only public repositories are scanned. ")
 
@@ -140,19 +389,16 @@ func cloneuserrepos(ctx context.Context, client *github.Client, user string) err
 		opt3.Page = resp.NextPage
 	}
 
-	var userrepowg sync.WaitGroup
 	//iterating through the userRepos array
 	for _, userRepo := range userRepos {
-		userrepowg.Add(1)
-		go executeclone(userRepo, "/tmp/repos/users/"+user+"/"+*userRepo.Name, &userrepowg)
+		executeclone(ctx, client, userRepo, "/tmp/repos/users/"+user+"/"+*userRepo.Name, user, p)
 	}
 
-	userrepowg.Wait()
-	fmt.Println("Done cloning user repos.")
+	fmt.Println("Done queueing user repos.")
 	return nil
 }
 
-func cloneusergists(ctx context.Context, client *github.Client, user string) error {
+func cloneusergists(ctx context.Context, client *github.Client, user string, p *pipeline) error {
 	Info("Cloning " + user + "'s gists")
 	Info("Irrespective of the scanPrivateReposOnly flag being set or not, this will scan all public AND secret gists of a user whose token is provided")
 
@@ -172,11 +418,8 @@ func cloneusergists(ctx context.Context, client *github.Client, user string) err
 		opt4.Page = resp.NextPage
 	}
 
-	var usergistclone sync.WaitGroup
 	//iterating through the userGists array
 	for _, userGist := range userGists {
-		usergistclone.Add(1)
-
 		if *enterpriseURL != "" {
 			d := strings.Split(*userGist.GitPullURL, "/")[2]
 			f := strings.Split(*userGist.GitPullURL, "/")[4]
@@ -185,17 +428,10 @@ func cloneusergists(ctx context.Context, client *github.Client, user string) err
 			gisturl = *userGist.GitPullURL
 		}
 
-		fmt.Println(gisturl)
-
 		//cloning the individual user gists
-		func(gisturl string, userGist *github.Gist, user string, usergistclone *sync.WaitGroup) {
-			enqueueJob(func() {
-				gitclone(gisturl, "/tmp/repos/users/"+user+"/"+*userGist.ID, usergistclone)
-			})
-		}(gisturl, userGist, user, &usergistclone)
+		p.clone(gisturl, "/tmp/repos/users/"+user+"/"+*userGist.ID, *userGist.ID, user)
 	}
 
-	usergistclone.Wait()
 	return nil
 }
 
@@ -219,7 +455,7 @@ func listallusers(ctx context.Context, client *github.Client, org string) ([]*gi
 	return allUsers, nil
 }
 
-func cloneTeamRepos(ctx context.Context, client *github.Client, org string, teamName string) error {
+func cloneTeamRepos(ctx context.Context, client *github.Client, org string, teamName string, p *pipeline) error {
 
 	// var team *github.Team
 	team, err := findTeamByName(ctx, client, org, teamName)
@@ -242,16 +478,11 @@ func cloneTeamRepos(ctx context.Context, client *github.Client, org string, team
 			listTeamRepoOpts.Page = resp.NextPage
 		}
 
-		var teamrepowg sync.WaitGroup
-
 		//iterating through the repo array
 		for _, repo := range teamRepos {
-			teamrepowg.Add(1)
-			go executeclone(repo, "/tmp/repos/team/"+*repo.Name, &teamrepowg)
+			executeclone(ctx, client, repo, "/tmp/repos/team/"+*repo.Name, org, p)
 		}
 
-		teamrepowg.Wait()
-
 	} else {
 		fmt.Println("Unable to find the team '" + teamName + "'; perhaps the user is not a member?\n")
 		if err != nil {
@@ -272,6 +503,7 @@ func authenticatetogit(ctx context.Context, token string) (*github.Client, error
 		&oauth2.Token{AccessToken: token},
 	)
 	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = countingTransport{base: tc.Transport}
 
 	if *enterpriseURL == "" {
 		client = github.NewClient(tc)
@@ -284,6 +516,17 @@ func authenticatetogit(ctx context.Context, token string) (*github.Client, error
 	return client, nil
 }
 
+// countingTransport counts the calls made to the API for the run summary
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	summary.apiCall(resp)
+	return resp, err
+}
+
 func findTeamByName(ctx context.Context, client *github.Client, org string, teamName string) (*github.Team, error) {
 
 	listTeamsOpts := &github.ListOptions{
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestClassifyCloneError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{"no commits since the since date",
+			"Cloning into 'repo'...\nfatal: no commits selected for shallow requests\nfatal: the remote end hung up unexpectedly\n",
+			cloneErrorNoCommits},
+		{"https auth",
+			"Cloning into 'repo'...\nfatal: could not read Username for 'https://github.com': terminal prompts disabled\n",
+			cloneErrorAuth},
+		{"ssh auth",
+			"Cloning into 'repo'...\ngit@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.\n",
+			cloneErrorAuth},
+		{"https not found",
+			"Cloning into 'repo'...\nremote: Repository not found.\nfatal: repository 'https://github.com/o/r.git/' not found\n",
+			cloneErrorNotFound},
+		{"ssh not found",
+			"Cloning into 'repo'...\nERROR: Repository not found.\nfatal: Could not read from remote repository.\n",
+			cloneErrorNotFound},
+		{"server error",
+			"Cloning into 'repo'...\nerror: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502\nfatal: the remote end hung up unexpectedly\n",
+			cloneErrorServer},
+		{"dns",
+			"Cloning into 'repo'...\nfatal: unable to access 'https://github.com/o/r.git/': Could not resolve host: github.com\n",
+			cloneErrorNetwork},
+		{"transfer cut short",
+			"Cloning into 'repo'...\nerror: RPC failed; curl 18 transfer closed with outstanding read data remaining\nfatal: the remote end hung up unexpectedly\nfatal: early EOF\nfatal: index-pack failed\n",
+			cloneErrorNetwork},
+		{"connection dropped",
+			"Cloning into 'repo'...\nfatal: the remote end hung up unexpectedly\n",
+			cloneErrorNetwork},
+		{"tls handshake dropped",
+			"Cloning into 'repo'...\nfatal: unable to access 'https://github.com/o/r.git/': gnutls_handshake() failed: The TLS connection was non-properly terminated.\n",
+			cloneErrorNetwork},
+		{"certificate",
+			"Cloning into 'repo'...\nfatal: unable to access 'https://github.example.com/o/r.git/': SSL certificate problem: unable to get local issuer certificate\n",
+			cloneErrorOther},
+		{"permanent error before the hang up",
+			"Cloning into 'repo'...\nfatal: remote error: upload-pack: not our ref 1234\nfatal: the remote end hung up unexpectedly\n",
+			cloneErrorOther},
+	}
+
+	for _, test := range tests {
+		if got := classifyCloneError(test.stderr); got != test.want {
+			t.Errorf("%s: classified as %q, want %q", test.name, got, test.want)
+		}
+	}
+}
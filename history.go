@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// historyCommit is the commit being read from the git log output
+type historyCommit struct {
+	hash    string
+	date    string
+	subject string
+}
+
+// scanHistory runs the native scanner over the lines added by every commit reachable from any ref,
+// and over the archives committed at any point, restricted to the since or depth window.
+func scanHistory(ctx context.Context, path string, rules *ruleSet) ([]truffleHogOutput, error) {
+	params := []string{"-C", path, "log", "--all", "--no-color", "--no-renames", "--raw", "--no-abbrev", "-p", "-U0",
+		"--date=iso", "--format=%x00%H%x00%ad%x00%s"}
+	if *since != "" {
+		params = append(params, "--since="+*since)
+	} else if *depth > 0 {
+		params = append(params, "--max-count="+strconv.Itoa(*depth))
+	}
+
+	cmd := exec.CommandContext(ctx, "/usr/bin/git", params...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	wait, err := startCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := parseHistory(ctx, stdout, path, rules)
+
+	err = wait()
+	if err == context.DeadlineExceeded {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	return findings, nil
+}
+
+func parseHistory(ctx context.Context, r io.Reader, repoPath string, rules *ruleSet) []truffleHogOutput {
+	var findings []truffleHogOutput
+	var commit historyCommit
+	var file string
+	var added []string
+	inHunk := false
+	seenArchives := make(map[string]bool)
+
+	flush := func() {
+		if file != "" && len(added) > 0 {
+			for _, finding := range scanContent([]byte(strings.Join(added, "\n")), file, rules) {
+				findings = append(findings, commit.annotate(finding))
+			}
+		}
+		added = nil
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			flush()
+			fields := strings.SplitN(line, "\x00", 4)
+			for len(fields) < 4 {
+				fields = append(fields, "")
+			}
+			commit = historyCommit{hash: fields[1], date: fields[2], subject: fields[3]}
+			file, inHunk = "", false
+
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			file, inHunk = "", false
+
+		case inHunk:
+			if strings.HasPrefix(line, "+") {
+				added = append(added, line[1:])
+			}
+
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(unquotePath(strings.TrimPrefix(line, "+++ ")), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+
+		case strings.HasPrefix(line, ":"):
+			// raw lines, like ":100644 100644 <old blob> <new blob> M\tpath", are how binary
+			// archives show up since there is no patch for them
+			tab := strings.Index(line, "\t")
+			if tab == -1 {
+				continue
+			}
+			fields := strings.Fields(line[:tab])
+			if len(fields) < 4 {
+				continue
+			}
+			blob, name := fields[3], unquotePath(line[tab+1:])
+			if !isArchive(name) || strings.Trim(blob, "0") == "" || seenArchives[blob] {
+				continue
+			}
+			seenArchives[blob] = true
+			for _, finding := range scanBlobArchive(ctx, repoPath, blob, name, rules) {
+				findings = append(findings, commit.annotate(finding))
+			}
+		}
+	}
+	flush()
+
+	return findings
+}
+
+// unquotePath undoes the quoting git applies to paths with special characters, such as
+// "dir/caf\303\251.txt", which uses the escapes of C and therefore of Go string literals
+func unquotePath(path string) string {
+	if strings.HasPrefix(path, `"`) {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			return unquoted
+		}
+	}
+	return path
+}
+
+func (c historyCommit) annotate(finding truffleHogOutput) truffleHogOutput {
+	finding.CommitHash = c.hash
+	finding.Date = c.date
+	finding.Commit = c.subject
+	return finding
+}
+
+// scanBlobArchive scans the archive stored in a git blob, unless it is larger than maxArchiveSize
+func scanBlobArchive(ctx context.Context, repoPath string, blob string, name string, rules *ruleSet) []truffleHogOutput {
+	size, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", repoPath, "cat-file", "-s", blob))
+	if err != nil {
+		return nil
+	}
+	if n, _ := strconv.ParseInt(strings.TrimSpace(string(size)), 10, 64); n > int64(*maxArchiveSize)<<20 {
+		return nil
+	}
+
+	content, err := outputCommand(ctx, exec.CommandContext(ctx, "/usr/bin/git", "-C", repoPath, "cat-file", "blob", blob))
+	if err != nil {
+		return nil
+	}
+	return scanArchive(content, name, rules)
+}
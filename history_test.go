@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// logCommit formats a commit header the way scanHistory asks git log for it
+func logCommit(hash string, subject string) string {
+	return "\x00" + hash + "\x002020-01-01 10:00:00 +0000\x00" + subject + "\n"
+}
+
+// logDiff formats the patch of one file, the new path being as git prints it, quoted or not
+func logDiff(newPath string, lines ...string) string {
+	return "\ndiff --git a/x b/x\nindex 0000000..1111111 100644\n--- a/x\n+++ " + newPath + "\n@@ -1 +1,2 @@\n" +
+		strings.Join(lines, "\n") + "\n"
+}
+
+func TestParseHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want []string
+	}{
+		{"added line",
+			logCommit("c1", "Add config") + logDiff("b/config/app.env", "+TOKEN=tok_abcd1234", "+other"),
+			[]string{"c1 config/app.env"}},
+		{"removed line",
+			logCommit("c1", "Remove config") + logDiff("b/config/app.env", "-TOKEN=tok_abcd1234"),
+			nil},
+		{"context line",
+			logCommit("c1", "Edit config") + logDiff("b/config/app.env", " TOKEN=tok_abcd1234", "+other"),
+			nil},
+		{"deleted file",
+			logCommit("c1", "Delete config") + logDiff("/dev/null", "+TOKEN=tok_abcd1234"),
+			nil},
+		{"quoted path",
+			logCommit("c1", "Add config") + logDiff(`"b/conf ig/caf\303\251 \"x\"\t.env"`, "+TOKEN=tok_abcd1234"),
+			[]string{"c1 conf ig/café \"x\"\t.env"}},
+		{"each commit and file on its own",
+			logCommit("c1", "First") + logDiff("b/a.env", "+TOKEN=tok_abcd1234") + logDiff("b/b.env", "+nothing") +
+				logCommit("c2", "Second") + logDiff("b/b.env", "+TOKEN=tok_efgh5678"),
+			[]string{"c1 a.env", "c2 b.env"}},
+		{"raw lines of files that are not archives",
+			logCommit("c1", "Add config") +
+				":000000 100644 0000000000000000000000000000000000000000 1111111111111111111111111111111111111111 A\tconfig/app.env\n" +
+				logDiff("b/config/app.env", "+TOKEN=tok_abcd1234"),
+			[]string{"c1 config/app.env"}},
+	}
+
+	rules := testRuleSet(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, finding := range parseHistory(context.Background(), strings.NewReader(test.log), "", rules) {
+				got = append(got, finding.CommitHash+" "+finding.Path)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("found secrets in %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestScanHistory runs git on a repo with a secret in a file with a quoted path and one in a committed archive
+func TestScanHistory(t *testing.T) {
+	if _, err := os.Stat("/usr/bin/git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("/usr/bin/git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name string, content []byte) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("café.env", []byte("TOKEN=tok_abcd1234\n"))
+	write("dist/app.zip", makeZip(t, archiveFile{"inner.tar.gz", makeTarGz(t, archiveFile{"app.env", []byte("tok_efgh5678")})}))
+	git("add", ".")
+	git("commit", "-q", "-m", "Add the app")
+
+	findings, err := scanHistory(context.Background(), dir, testRuleSet(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.Path+" "+finding.Commit)
+	}
+	sort.Strings(got)
+	want := []string{"café.env Add the app", "dist/app.zip!/inner.tar.gz!/app.env Add the app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("found secrets in %q, want %q", got, want)
+	}
+}
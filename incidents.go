@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A secret incident is one secret value along with everywhere it was found, so a key leaked
+// into many forks is rotated once. Secrets are identified by a salted hash, which is stable
+// for as long as the same salt is used and doesn't reveal the secret.
+type secretIncident struct {
+	Fingerprint  string       `json:"fingerprint"`
+	Rule         string       `json:"rule"`
+	RuleID       string       `json:"ruleId"`
+	Severity     string       `json:"severity"`
+	Verification string       `json:"verification,omitempty"`
+	Repositories int          `json:"repositories"`
+	Occurrences  []occurrence `json:"occurrences"`
+}
+
+type occurrence struct {
+	Repository string `json:"repository"`
+	Source     string `json:"source,omitempty"`
+	Tool       string `json:"tool"`
+	Path       string `json:"path"`
+	CommitHash string `json:"commitHash,omitempty"`
+}
+
+var (
+	fingerprintKeyOnce sync.Once
+	fingerprintKey     []byte
+)
+
+// secretFingerprint returns the HMAC-SHA256 of a secret keyed with the fingerprintSalt flag.
+// Without a salt a random one is made up, and fingerprints only hold for this run.
+func secretFingerprint(secret string) string {
+	fingerprintKeyOnce.Do(func() {
+		if *fingerprintSalt != "" {
+			fingerprintKey = []byte(*fingerprintSalt)
+			return
+		}
+		fingerprintKey = make([]byte, 32)
+		_, err := rand.Read(fingerprintKey)
+		check(err)
+		fmt.Println("No fingerprintSalt was provided, so the secret fingerprints of this run can't be compared with other runs")
+	})
+
+	mac := hmac.New(sha256.New, fingerprintKey)
+	mac.Write([]byte(secret))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fingerprintSecrets fingerprints the secret in each match of a rule, which is the first capture
+// group of the rule's regex when it has one, so a key matched by different rules gets one fingerprint.
+// Private key headers are the same for every key, so they get an empty fingerprint.
+func fingerprintSecrets(r rule, stringsFound []string) []string {
+	var fingerprints []string
+	for _, match := range stringsFound {
+		if header := privateKeyHeader(match); header != "" && header == strings.TrimSpace(match) {
+			fingerprints = append(fingerprints, "")
+			continue
+		}
+		fingerprints = append(fingerprints, secretFingerprint(r.secret(match)))
+	}
+	return fingerprints
+}
+
+// fingerprintKeys fingerprints the private keys parsed for a finding by their public key
+func fingerprintKeys(keys []privateKeyInfo) []string {
+	var fingerprints []string
+	for _, key := range keys {
+		if key.Fingerprint != "" {
+			fingerprints = append(fingerprints, secretFingerprint(key.Fingerprint))
+		}
+	}
+	return fingerprints
+}
+
+// groupIncidents turns the findings of all the repos into one incident per fingerprint,
+// the most severe and the most widespread first
+func groupIncidents(results []repositoryScan) []secretIncident {
+	var incidents []*secretIncident
+	byFingerprint := make(map[string]*secretIncident)
+	repos := make(map[string]map[string]bool)
+
+	for _, scan := range results {
+		for _, f := range scan.Findings {
+			for _, fingerprint := range f.Fingerprints {
+				if fingerprint == "" {
+					continue
+				}
+				incident, ok := byFingerprint[fingerprint]
+				if !ok {
+					incident = &secretIncident{Fingerprint: fingerprint, Rule: f.Rule, RuleID: f.RuleID, Severity: f.Severity}
+					byFingerprint[fingerprint] = incident
+					incidents = append(incidents, incident)
+					repos[fingerprint] = make(map[string]bool)
+				}
+				if severityRank(f.Severity) < severityRank(incident.Severity) {
+					incident.Rule, incident.RuleID, incident.Severity = f.Rule, f.RuleID, f.Severity
+				}
+				if verificationRank(f.Verification) < verificationRank(incident.Verification) {
+					incident.Verification = f.Verification
+				}
+
+				o := occurrence{Repository: scan.Repository, Source: scan.Source, Tool: f.Tool, Path: f.Path, CommitHash: f.CommitHash}
+				if !containsOccurrence(incident.Occurrences, o) {
+					incident.Occurrences = append(incident.Occurrences, o)
+				}
+				repos[fingerprint][scan.Repository] = true
+			}
+		}
+	}
+
+	sorted := make([]secretIncident, 0, len(incidents))
+	for _, incident := range incidents {
+		incident.Repositories = len(repos[incident.Fingerprint])
+		sorted = append(sorted, *incident)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Severity != sorted[j].Severity {
+			return severityRank(sorted[i].Severity) < severityRank(sorted[j].Severity)
+		}
+		return sorted[i].Repositories > sorted[j].Repositories
+	})
+	return sorted
+}
+
+// verificationRank orders verification results from the most to the least conclusive
+func verificationRank(verification string) int {
+	switch verification {
+	case verified:
+		return 0
+	case unverified:
+		return 1
+	case invalid:
+		return 2
+	}
+	return 3
+}
+
+func containsOccurrence(occurrences []occurrence, o occurrence) bool {
+	for _, existing := range occurrences {
+		if existing == o {
+			return true
+		}
+	}
+	return false
+}
+
+func writeIncidents(results []repositoryScan, outputfile string) {
+	incidents := groupIncidents(results)
+	marshalledIncidents, err := json.Marshal(incidents)
+	check(err)
+	err = ioutil.WriteFile(outputfile, marshalledIncidents, 0600)
+	check(err)
+	fmt.Printf("Found %d distinct secrets, written to %s\n", len(incidents), outputfile)
+}
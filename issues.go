@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"path"
+	"strconv"
+
+	"github.com/google/go-github/github"
+)
+
+// collectissues writes the text of every issue, pull request, comment and review of a repo
+// into the documents workspace. Issues and pull requests share their numbers, so the layout is
+// issues/<number>/body.md, issues/<number>/comments/<id>.md,
+// issues/<number>/review-comments/<id>.md and issues/<number>/reviews/<id>.md
+func collectissues(ctx context.Context, client *github.Client, owner string, repo string) error {
+	dir := documentDir(owner, repo, "issues") + "/"
+
+	var pulls []int
+	opt := &github.IssueListByRepoOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, opt)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			number := strconv.Itoa(issue.GetNumber())
+			err := writeDocument(dir+number+"/body.md", issue.GetTitle()+"\n\n"+issue.GetBody())
+			if err != nil {
+				return err
+			}
+			if issue.PullRequestLinks != nil {
+				pulls = append(pulls, issue.GetNumber())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	// number 0 lists the comments of all the issues of the repo
+	commentOpt := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, 0, commentOpt)
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			number := path.Base(comment.GetIssueURL())
+			err := writeDocument(dir+number+"/comments/"+strconv.FormatInt(comment.GetID(), 10)+".md", comment.GetBody())
+			if err != nil {
+				return err
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpt.Page = resp.NextPage
+	}
+
+	// number 0 lists the review comments of all the pull requests of the repo
+	reviewCommentOpt := &github.PullRequestListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, 0, reviewCommentOpt)
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			number := path.Base(comment.GetPullRequestURL())
+			err := writeDocument(dir+number+"/review-comments/"+strconv.FormatInt(comment.GetID(), 10)+".md", comment.GetBody())
+			if err != nil {
+				return err
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewCommentOpt.Page = resp.NextPage
+	}
+
+	// reviews can only be listed per pull request
+	for _, number := range pulls {
+		reviewOpt := &github.ListOptions{PerPage: 100}
+		for {
+			reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, number, reviewOpt)
+			if err != nil {
+				return err
+			}
+			for _, review := range reviews {
+				if review.GetBody() == "" {
+					continue
+				}
+				err := writeDocument(dir+strconv.Itoa(number)+"/reviews/"+strconv.FormatInt(review.GetID(), 10)+".md", review.GetBody())
+				if err != nil {
+					return err
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			reviewOpt.Page = resp.NextPage
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// The journal records how far each repo got, one JSON line per step, so an interrupted run can be
+// picked up with the resume flag. The results of the steps are in the workspace, so resuming
+// needs /tmp to be a volume that outlives the container.
+
+const journalPath = "/tmp/journal.jsonl"
+
+// Steps of a repo in the journal
+const (
+	stepEnumerated = "enumerated"
+	stepCloned     = "cloned"
+	stepScanned    = "scanned"
+	stepCollected  = "collected"
+	stepMerged     = "merged"
+)
+
+type journalEntry struct {
+	Repository string `json:"repository,omitempty"`
+	Step       string `json:"step"`
+	Detail     string `json:"detail,omitempty"`
+	Time       string `json:"time"`
+}
+
+type jobJournal struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[journalEntry]bool
+}
+
+var journal = &jobJournal{done: make(map[journalEntry]bool)}
+
+// openJournal starts a new journal, or carries on with the one of the interrupted run when resuming
+func openJournal() error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	cut := false
+	if *resume {
+		var err error
+		cut, err = journal.load()
+		if os.IsNotExist(err) {
+			fmt.Println("There is no journal at " + journalPath + " to resume from, so starting from scratch")
+		} else if err != nil {
+			return err
+		} else if journal.has("", stepMerged, "") {
+			// the results of a run that completed may be shredded or encrypted since
+			fmt.Println("The run of the journal at " + journalPath + " completed, so starting from scratch")
+			journal.done = make(map[journalEntry]bool)
+			cut = false
+		} else {
+			fmt.Printf("Resuming from %s, with %d steps already done\n", journalPath, len(journal.done))
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	file, err := os.OpenFile(journalPath, flags, 0600)
+	if err != nil {
+		return err
+	}
+	journal.file = file
+	if cut {
+		// the interruption cut the last line short, so it is ended before carrying on
+		_, err = file.Write([]byte("\n"))
+	}
+	return err
+}
+
+// load reads the journal of the interrupted run, telling whether its last line was cut short
+func (j *jobJournal) load() (bool, error) {
+	content, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		var entry journalEntry
+		if json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		entry.Time = ""
+		j.done[entry] = true
+	}
+	return len(content) > 0 && content[len(content)-1] != '\n', nil
+}
+
+// record appends a step done to the journal
+func (j *jobJournal) record(repository string, step string, detail string) {
+	entry := journalEntry{Repository: repository, Step: step, Detail: detail}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done[entry] = true
+	if j.file == nil {
+		return
+	}
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(entry)
+	check(err)
+	_, err = j.file.Write(append(line, '\n'))
+	check(err)
+}
+
+// has tells whether a step was done, in this run or in the run being resumed
+func (j *jobJournal) has(repository string, step string, detail string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.done[journalEntry{Repository: repository, Step: step, Detail: detail}]
+}
+
+// scannedByAll tells whether every tool in use is done with a repo
+func (j *jobJournal) scannedByAll(repository string) bool {
+	for _, tool := range scanTools(*toolName) {
+		if !j.has(repository, stepScanned, tool) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanTools lists the tools run by the toolName flag, by the names of their results files
+func scanTools(tool string) []string {
+	switch tool {
+	case "thog":
+		return []string{"truffleHog"}
+	case "repo-supervisor":
+		return []string{"repo-supervisor"}
+	case "native":
+		return []string{"native"}
+	}
+	return []string{"truffleHog", "repo-supervisor", "native"}
+}
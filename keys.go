@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Private key headers fire on documentation snippets and truncated examples as much as on
+// real keys, so the native scanner parses the key blocks it finds to tell them apart.
+
+// privateKeyInfo describes one private key block. Fingerprints are the SHA256 ones of
+// ssh-keygen -l, computed from the public key, so they can be looked up in authorized_keys.
+type privateKeyInfo struct {
+	Type        string `json:"type"`
+	Bits        int    `json:"bits,omitempty"`
+	Encrypted   bool   `json:"encrypted"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+const privateKeyMarker = "PRIVATE KEY-----"
+
+// privateKeyHeader returns the private key header a match starts with, if it does
+func privateKeyHeader(match string) string {
+	end := strings.Index(match, privateKeyMarker)
+	if !strings.HasPrefix(match, "-----BEGIN ") || end == -1 {
+		return ""
+	}
+	return match[:end+len(privateKeyMarker)]
+}
+
+var ed25519OID = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// inspectPrivateKeys parses every private key block in content. Blocks written on one line
+// with \n escapes, as in JSON files and string literals, are unescaped first.
+func inspectPrivateKeys(content []byte) []privateKeyInfo {
+	var keys []privateKeyInfo
+	text := string(content)
+
+	for {
+		start := strings.Index(text, "-----BEGIN ")
+		if start == -1 {
+			break
+		}
+		text = text[start+len("-----BEGIN "):]
+		kindEnd := strings.Index(text, "-----")
+		if kindEnd == -1 {
+			break
+		}
+		kind := text[:kindEnd]
+		if !strings.HasSuffix(kind, "PRIVATE KEY") {
+			text = text[kindEnd:]
+			continue
+		}
+		text = "-----BEGIN " + text
+
+		footer := "-----END " + kind + "-----"
+		end := strings.Index(text, footer)
+		if end == -1 {
+			keys = append(keys, privateKeyInfo{Type: keyType(kind), Error: "the key block has no end"})
+			break
+		}
+		block := strings.Replace(text[:end+len(footer)], `\n`, "\n", -1)
+		keys = append(keys, parsePrivateKey([]byte(block), kind))
+		text = text[end+len(footer):]
+	}
+	return keys
+}
+
+// keyType guesses the key type from a PEM block type, like RSA for RSA PRIVATE KEY
+func keyType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "RSA "):
+		return "rsa"
+	case strings.HasPrefix(kind, "EC "):
+		return "ecdsa"
+	case strings.HasPrefix(kind, "DSA "):
+		return "dsa"
+	case strings.HasPrefix(kind, "OPENSSH "):
+		return "openssh"
+	}
+	return "unknown"
+}
+
+func parsePrivateKey(block []byte, kind string) privateKeyInfo {
+	info := privateKeyInfo{Type: keyType(kind)}
+
+	p, _ := pem.Decode(block)
+	if p == nil {
+		info.Error = "the key block is not valid PEM"
+		return info
+	}
+
+	var err error
+	switch p.Type {
+	case "OPENSSH PRIVATE KEY":
+		err = info.parseOpenSSH(p.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		info.Encrypted = true
+	default:
+		// the legacy PEM encryption of OpenSSL, which x509 has deprecated along with its parser
+		if p.Headers["Proc-Type"] == "4,ENCRYPTED" {
+			info.Encrypted = true
+			break
+		}
+		err = info.parsePEM(p)
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+func (info *privateKeyInfo) parsePEM(p *pem.Block) error {
+	switch p.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(p.Bytes)
+		if err != nil {
+			return err
+		}
+		info.setKey(key)
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(p.Bytes)
+		if err != nil {
+			return err
+		}
+		info.setKey(key)
+	case "DSA PRIVATE KEY":
+		var key struct {
+			Version       int
+			P, Q, G, Y, X *big.Int
+		}
+		if _, err := asn1.Unmarshal(p.Bytes, &key); err != nil {
+			return err
+		}
+		info.Type, info.Bits = "dsa", key.P.BitLen()
+		info.Fingerprint = sshFingerprint(sshString([]byte("ssh-dss")), sshMpint(key.P), sshMpint(key.Q), sshMpint(key.G), sshMpint(key.Y))
+	case "PRIVATE KEY":
+		// ed25519 keys are checked for first, as not every Go version's x509 knows them
+		var pkcs8 struct {
+			Version    int
+			Algorithm  pkix.AlgorithmIdentifier
+			PrivateKey []byte
+			Attributes asn1.RawValue  `asn1:"optional,tag:0"`
+			PublicKey  asn1.BitString `asn1:"optional,tag:1"`
+		}
+		if _, err := asn1.Unmarshal(p.Bytes, &pkcs8); err == nil && pkcs8.Algorithm.Algorithm.Equal(ed25519OID) {
+			info.Type, info.Bits = "ed25519", 256
+			return info.setEd25519Key(pkcs8.PrivateKey, pkcs8.PublicKey.Bytes)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+		if err != nil {
+			return err
+		}
+		info.setKey(key)
+	default:
+		return fmt.Errorf("unknown key block type %s", p.Type)
+	}
+	return nil
+}
+
+func (info *privateKeyInfo) setKey(key interface{}) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		info.Type, info.Bits = "rsa", k.N.BitLen()
+		info.Fingerprint = sshFingerprint(sshString([]byte("ssh-rsa")), sshMpint(big.NewInt(int64(k.E))), sshMpint(k.N))
+	case *ecdsa.PrivateKey:
+		curve := "nistp" + fmt.Sprint(k.Curve.Params().BitSize)
+		info.Type, info.Bits = "ecdsa", k.Curve.Params().BitSize
+		info.Fingerprint = sshFingerprint(sshString([]byte("ecdsa-sha2-"+curve)), sshString([]byte(curve)), sshString(elliptic.Marshal(k.Curve, k.X, k.Y)))
+	default:
+		info.Type = fmt.Sprintf("%T", key)
+	}
+}
+
+// setEd25519Key fingerprints a PKCS8 ed25519 key. Version 2 keys hold the public key, and for the
+// others it is derived from the seed the private key is.
+func (info *privateKeyInfo) setEd25519Key(privateKey []byte, public []byte) error {
+	if len(public) != 32 {
+		var seed []byte
+		if _, err := asn1.Unmarshal(privateKey, &seed); err != nil {
+			return err
+		}
+		if len(seed) != 32 {
+			return fmt.Errorf("the ed25519 key is %d bytes instead of 32", len(seed))
+		}
+		public = ed25519PublicKey(seed)
+	}
+	info.Fingerprint = sshFingerprint(sshString([]byte("ssh-ed25519")), sshString(public))
+	return nil
+}
+
+// parseOpenSSH reads the openssh-key-v1 format of ssh-keygen. The public key is stored in the
+// clear, so even encrypted keys have a type, size and fingerprint.
+func (info *privateKeyInfo) parseOpenSSH(data []byte) error {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return fmt.Errorf("the key is not in the openssh-key-v1 format")
+	}
+	r := &sshReader{data: data[len(magic):]}
+	cipher := r.string()
+	r.string() // kdf name
+	r.string() // kdf options
+	r.uint32() // number of keys
+	public := r.string()
+	if r.err != nil {
+		return r.err
+	}
+	info.Encrypted = string(cipher) != "none"
+	info.Fingerprint = sshFingerprint(public)
+
+	pr := &sshReader{data: public}
+	keyType := string(pr.string())
+	switch {
+	case keyType == "ssh-rsa":
+		pr.string() // e
+		info.Type, info.Bits = "rsa", new(big.Int).SetBytes(pr.string()).BitLen()
+	case keyType == "ssh-dss":
+		info.Type, info.Bits = "dsa", new(big.Int).SetBytes(pr.string()).BitLen()
+	case keyType == "ssh-ed25519":
+		info.Type, info.Bits = "ed25519", 256
+	case strings.HasPrefix(keyType, "ecdsa-sha2-nistp"):
+		info.Type = "ecdsa"
+		fmt.Sscan(strings.TrimPrefix(keyType, "ecdsa-sha2-nistp"), &info.Bits)
+	default:
+		info.Type = keyType
+	}
+	return pr.err
+}
+
+// sshReader reads the length prefixed fields of the SSH wire format
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = fmt.Errorf("the key is truncated")
+		return 0
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return n
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = fmt.Errorf("the key is truncated")
+		return nil
+	}
+	s := r.data[:n]
+	r.data = r.data[n:]
+	return s
+}
+
+func sshString(s []byte) []byte {
+	out := make([]byte, 4, 4+len(s))
+	binary.BigEndian.PutUint32(out, uint32(len(s)))
+	return append(out, s...)
+}
+
+func sshMpint(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return sshString(b)
+}
+
+// sshFingerprint hashes the fields of a public key in the SSH wire format
+func sshFingerprint(fields ...[]byte) string {
+	sum := sha256.Sum256(bytes.Join(fields, nil))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// checkPrivateKeys adds the keys parsed from content to the findings of private key headers.
+// When none of the blocks parse, the finding is likely a snippet and is downgraded to low.
+func checkPrivateKeys(findings []truffleHogOutput, content []byte) {
+	addPrivateKeys(findings, func() []privateKeyInfo { return inspectPrivateKeys(content) })
+}
+
+// checkThogPrivateKeys does the same for the findings of truffleHog, from the diffs they come with
+func checkThogPrivateKeys(issues []truffleHogOutput) {
+	for i := range issues {
+		if len(issues[i].Keys) > 0 || issues[i].Diff == "" {
+			continue
+		}
+		diff := issues[i].Diff
+		addPrivateKeys(issues[i:i+1], func() []privateKeyInfo { return inspectDiffPrivateKeys(diff) })
+	}
+}
+
+// inspectDiffPrivateKeys parses the private key blocks on either side of a diff. The sides are
+// parsed apart, so that a key the commit replaces is not mixed up with the new one.
+func inspectDiffPrivateKeys(diff string) []privateKeyInfo {
+	var added, removed []string
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, line[1:])
+		case strings.HasPrefix(line, " "):
+			added = append(added, line[1:])
+			removed = append(removed, line[1:])
+		}
+	}
+
+	keys := inspectPrivateKeys([]byte(strings.Join(added, "\n")))
+	for _, key := range inspectPrivateKeys([]byte(strings.Join(removed, "\n"))) {
+		found := false
+		for _, k := range keys {
+			if k == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// addPrivateKeys adds the keys returned by inspect to the findings of private key headers,
+// downgrading them when none of the keys parse. inspect is only called when there are such findings.
+func addPrivateKeys(findings []truffleHogOutput, inspect func() []privateKeyInfo) {
+	var keys []privateKeyInfo
+	inspected := false
+
+	for i := range findings {
+		if !containsSubstring(findings[i].StringsFound, privateKeyMarker) {
+			continue
+		}
+		if !inspected {
+			keys = inspect()
+			inspected = true
+		}
+
+		findings[i].Keys = keys
+		parsed := false
+		for _, key := range keys {
+			if key.Error == "" {
+				parsed = true
+			}
+		}
+		if !parsed {
+			findings[i].Severity = "low"
+		}
+	}
+}
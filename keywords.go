@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+)
+
+// keywordMatcher finds which of a set of keywords appear in a line in a single pass,
+// using an Aho-Corasick automaton. Matching is case insensitive for ASCII letters.
+type keywordMatcher struct {
+	// delta is the transition table, 256 entries per state
+	delta []int32
+	// out lists the keywords ending at each state, including those reached through failure links
+	out [][]int
+}
+
+func newKeywordMatcher(keywords []string) *keywordMatcher {
+	children := []map[byte]int32{{}}
+	out := [][]int{nil}
+
+	for k, keyword := range keywords {
+		state := int32(0)
+		for _, c := range []byte(strings.ToLower(keyword)) {
+			next, ok := children[state][c]
+			if !ok {
+				next = int32(len(children))
+				children[state][c] = next
+				children = append(children, map[byte]int32{})
+				out = append(out, nil)
+			}
+			state = next
+		}
+		out[state] = append(out[state], k)
+	}
+
+	// breadth first, so the failure state of a state is complete before its children need it
+	m := &keywordMatcher{delta: make([]int32, 256*len(children)), out: out}
+	fail := make([]int32, len(children))
+	queue := []int32{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c := 0; c < 256; c++ {
+			next, ok := children[state][byte(c)]
+			if !ok {
+				if state != 0 {
+					m.delta[256*int(state)+c] = m.delta[256*int(fail[state])+c]
+				}
+				continue
+			}
+			m.delta[256*int(state)+c] = next
+			if state != 0 {
+				fail[next] = m.delta[256*int(fail[state])+c]
+				m.out[next] = append(m.out[next], m.out[fail[next]]...)
+			}
+			queue = append(queue, next)
+		}
+	}
+	return m
+}
+
+// find appends the index of every keyword occurrence in line to hits, which can hold duplicates
+func (m *keywordMatcher) find(line string, hits []int) []int {
+	state := int32(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		state = m.delta[256*int(state)+int(c)]
+		hits = append(hits, m.out[state]...)
+	}
+	return hits
+}
+
+// ruleSet holds rules along with a matcher over all their keywords, so a line is only tried
+// with the regexes of the rules whose keywords it contains, and of the rules without keywords.
+// When entropy is set, high entropy strings no rule matched are reported as well.
+type ruleSet struct {
+	rules     []rule
+	prefilter bool
+	entropy   *entropyDetector
+	matcher   *keywordMatcher
+	byKeyword [][]int
+	always    []int
+}
+
+func newRuleSet(rules []rule) *ruleSet {
+	set := &ruleSet{rules: rules, prefilter: true}
+	var keywords []string
+	index := make(map[string]int)
+
+	for i, r := range rules {
+		hasKeyword := false
+		for _, keyword := range r.Keywords {
+			if keyword == "" {
+				continue
+			}
+			hasKeyword = true
+			keyword = strings.ToLower(keyword)
+			k, ok := index[keyword]
+			if !ok {
+				k = len(keywords)
+				index[keyword] = k
+				keywords = append(keywords, keyword)
+				set.byKeyword = append(set.byKeyword, nil)
+			}
+			set.byKeyword[k] = append(set.byKeyword[k], i)
+		}
+		if !hasKeyword {
+			set.always = append(set.always, i)
+		}
+	}
+
+	set.matcher = newKeywordMatcher(keywords)
+	return set
+}
+
+// candidates returns the indexes of the rules worth trying on a line. seen is scratch space
+// with one entry per rule, marked with stamp, which must differ from line to line.
+func (set *ruleSet) candidates(line string, stamp int, seen []int, hits []int, rules []int) ([]int, []int) {
+	rules = append(rules[:0], set.always...)
+	hits = set.matcher.find(line, hits[:0])
+	for _, k := range hits {
+		for _, i := range set.byKeyword[k] {
+			if seen[i] != stamp {
+				seen[i] = stamp
+				rules = append(rules, i)
+			}
+		}
+	}
+	return hits, rules
+}
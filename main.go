@@ -8,19 +8,10 @@ import (
 	"log"
 	"os"
 	"strings"
-	"sync"
 
 	"github.com/google/go-github/github"
 )
 
-func enqueueJob(item func()) {
-	executionQueue <- true
-	go func() {
-		item()
-		<-executionQueue
-	}()
-}
-
 // Info Function to show colored text
 func Info(format string, args ...interface{}) {
 	fmt.Printf("\x1b[34;1m%s\x1b[0m\n", fmt.Sprintf(format, args...))
@@ -46,25 +37,58 @@ func makeDirectories() error {
 
 func main() {
 
+	//The rules subcommand has its own flags, so it is handled before parsing the scan flags
+	if len(os.Args) > 1 && os.Args[1] == "rules" {
+		os.Exit(rulescommand(os.Args[2:]))
+	}
+
 	//Parsing the flags
 	flag.Parse()
 
-	executionQueue = make(chan bool, *threads)
-
 	//Logic to check the program is ingesting proper flags
 	err := checkflags(*token, *org, *user, *repoURL, *gistURL, *teamName, *scanPrivateReposOnly, *orgOnly, *toolName, *enterpriseURL, *thogEntropy)
 	check(err)
 
-	ctx := context.Background()
+	err = checkfilterflags()
+	check(err)
+
+	err = checkhistoryflags()
+	check(err)
+
+	err = checkdocumentflags()
+	check(err)
+
+	err = checkruleflags()
+	check(err)
+
+	err = checkencryptflags()
+	check(err)
+
+	err = checkworkspaceflags()
+	check(err)
+
+	err = checkpoolflags()
+	check(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handleSignals(cancel)
+	makePools(ctx)
 
 	//authN
 	client, err := authenticatetogit(ctx, *token)
 	check(err)
 
-	//Creating some temp directories to store repos & results. These will be deleted in the end
+	//Creating some temp directories to store repos & results. The repos are deleted once scanned unless keepClones is used
 	err = makeDirectories()
 	check(err)
 
+	//The journal records how far each repo gets, for resuming the run if it is interrupted
+	err = openJournal()
+	check(err)
+
+	//The repos are scanned as soon as they are cloned, and deleted once scanned
+	p := newPipeline()
+
 	//By now, we either have the org, user, repoURL or the gistURL. The program flow changes accordingly..
 
 	if *org != "" { //If org was supplied
@@ -77,85 +101,65 @@ func main() {
 
 			Info(m)
 
-			//cloning all the repos of the org
-			err := cloneorgrepos(ctx, client, *org)
+			//cloning and scanning all the repos of the org
+			err := cloneorgrepos(ctx, client, *org, p)
 			check(err)
 
 			if *teamName != "" { //If team was supplied
-				Info("Since team name was provided, the tool will clone all repos to which the team has access")
+				Info("Since team name was provided, the tool will clone and scan all repos to which the team has access")
 
-				//cloning all the repos of the team
-				err := cloneTeamRepos(ctx, client, *org, *teamName)
+				//cloning and scanning all the repos of the team
+				err := cloneTeamRepos(ctx, client, *org, *teamName, p)
 				check(err)
 
 			}
 
-			//getting all the users of the org into the allUsers array
-			allUsers, err := listallusers(ctx, client, *org)
-			check(err)
-
 			if !*orgOnly {
+				//getting all the users of the org into the allUsers array
+				allUsers, err := listallusers(ctx, client, *org)
+				check(err)
 
 				//iterating through the allUsers array
 				for _, user := range allUsers {
 
-					//cloning all the repos of a user
-					err1 := cloneuserrepos(ctx, client, *user.Login)
+					//cloning and scanning all the repos of a user
+					err1 := cloneuserrepos(ctx, client, *user.Login, p)
 					check(err1)
 
-					//cloning all the gists of a user
-					err2 := cloneusergists(ctx, client, *user.Login)
+					//cloning and scanning all the gists of a user
+					err2 := cloneusergists(ctx, client, *user.Login, p)
 					check(err2)
 
 				}
 			}
-		}
-		if !*downloadOnly {
-			Info("Scanning all org repositories now..This may take a while so please be patient\n")
-			err = scanorgrepos(*org)
-			check(err)
-			Info("Finished scanning all org repositories\n")
+		} else {
+			Info("Scanning all the repositories on disk now..This may take a while so please be patient\n")
+			scanorgrepos(*org, p)
 
 			if *teamName != "" { //If team was supplied
-				Info("Scanning all team repositories now...This may take a while so please be patient\n")
-				err = scanTeamRepos(*org)
-				check(err)
-
-				Info("Finished scanning all team repositories\n")
+				scanTeamRepos(*org, p)
 			}
 
 			if !*orgOnly {
-
-				Info("Scanning all user repositories and gists now..This may take a while so please be patient\n")
-				var wguser sync.WaitGroup
 				users, _ := ioutil.ReadDir("/tmp/repos/users/")
 				for _, user := range users {
-					wguser.Add(1)
-					go scanforeachuser(user.Name(), &wguser)
+					scanforeachuser(user.Name(), p)
 				}
-				wguser.Wait()
-				Info("Finished scanning all user repositories and gists\n")
 			}
 		}
 	} else if *user != "" { //If user was supplied
 		if !*scanOnly {
 			Info("Since user was provided, the tool will proceed to scan all the user repos and user gists\n")
-			err1 := cloneuserrepos(ctx, client, *user)
+			err1 := cloneuserrepos(ctx, client, *user, p)
 			check(err1)
 
-			err2 := cloneusergists(ctx, client, *user)
+			err2 := cloneusergists(ctx, client, *user, p)
 			check(err2)
-		}
-		if !*downloadOnly {
-			Info("Scanning all user repositories and gists now..This may take a while so please be patient\n")
-			var wguseronly sync.WaitGroup
-			wguseronly.Add(1)
-			go scanforeachuser(*user, &wguseronly)
-			wguseronly.Wait()
-			Info("Finished scanning all user repositories and gists\n")
+		} else {
+			Info("Scanning all user repositories and gists on disk now..This may take a while so please be patient\n")
+			scanforeachuser(*user, p)
 		}
 	} else if *repoURL != "" || *gistURL != "" { //If either repoURL or gistURL was supplied
-
 		var url, repoorgist, fpath, rn, lastString, orgoruserName string
 		var splitArray []string
 		var bpath = "/tmp/repos/"
@@ -208,45 +212,78 @@ func main() {
 		}
 		fpath = bpath + orgoruserName + "/" + rn
 		if !*scanOnly {
-			//cloning
-			Info("Starting to clone: " + url + "\n")
-			var wgo sync.WaitGroup
-			wgo.Add(1)
-			func(url string, fpath string, wgo *sync.WaitGroup) {
-				enqueueJob(func() {
-					gitclone(url, fpath, wgo)
+			if *scanIssues && repoorgist == "repo" {
+				p.collect(orgoruserName+"/"+rn+" issues", func(ctx context.Context) {
+					collectdocuments(ctx, client, orgoruserName, rn, "issues", collectissues)
 				})
-			}(url, fpath, &wgo)
-			wgo.Wait()
-			Info("Cloning of: " + url + " finished\n")
-		}
-		if !*downloadOnly {
-			//scanning
-			Info("Starting to scan: " + url + "\n")
-			var wgs sync.WaitGroup
-			wgs.Add(1)
-
-			func(rn string, fpath string, wgs *sync.WaitGroup, orgoruserName string) {
-				enqueueJob(func() {
-					runGitTools(*toolName, fpath+"/", wgs, rn, orgoruserName)
+			}
+			if *scanActions && repoorgist == "repo" {
+				p.collect(orgoruserName+"/"+rn+" actions", func(ctx context.Context) {
+					collectdocuments(ctx, client, orgoruserName, rn, "actions", collectactions)
 				})
-			}(rn, fpath, &wgs, orgoruserName)
-
-			wgs.Wait()
-			Info("Scanning of: " + url + " finished\n")
+			}
+			if *scanReleases && repoorgist == "repo" {
+				p.collect(orgoruserName+"/"+rn+" releases", func(ctx context.Context) {
+					collectdocuments(ctx, client, orgoruserName, rn, "releases", collectreleases)
+				})
+			}
+			p.clone(url, fpath, rn, orgoruserName)
+		} else {
+			p.scan(fpath, rn, orgoruserName)
 		}
 	}
 
+	if *scanOnly {
+		//Scanning the documents collected by an earlier run, if any
+		scanDocuments()
+	}
+
+	//Waiting for the last repos to go through the pipeline
+	p.wait()
+	Info("Finished cloning and scanning\n")
+
+	if !*downloadOnly {
+		//The findings are counted for the summary while the per-repo results are still in the clear
+		summary.countFindings()
+	}
+
 	//Now, that all the scanning has finished, time to combine the output
 	// There are two option here:
 	if *mergeOutput {
 		// The first is to merge everything in /tmp/results into one JSON file
 		Info("Merging the output into one JSON file\n")
-		mergeOutputJSON(*outputFile)
+		mergeOutputJSON(ctx, *outputFile)
 	} else {
 		// The second is to just concat the outputs
 		Info("Combining the output into one file\n")
 		err = combineOutput(*toolName, *outputFile)
 		check(err)
 	}
+	journal.record("", stepMerged, "")
+
+	//The per-repo results are no longer needed once combined, and whatever is left is encrypted
+	if *shredResults {
+		err = shredIntermediates()
+		check(err)
+	}
+	summary.finish()
+	if *summaryOutput != "" {
+		err = summary.write(*summaryOutput)
+		check(err)
+	}
+	if *encryptKey != "" {
+		outputs := []string{*outputFile}
+		if *mergeOutput {
+			outputs = append(outputs, *incidentsOutput)
+		}
+		if *summaryOutput != "" {
+			outputs = append(outputs, *summaryOutput)
+		}
+		err = encryptResults(outputs)
+		check(err)
+	}
+
+	cleanupWorkspace()
+
+	summary.print()
 }
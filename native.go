@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The native scanner applies the same rules as truffleHog to git history and plain files,
+// including the content of archives, which the other tools can't look into.
+// Its output uses the truffleHog JSON format so the results can be merged the same way.
+
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// scanContent returns one finding per rule that matched the content, and one for the high
+// entropy strings, if entropy detection is on, that are not part of what the rules matched
+func scanContent(content []byte, path string, set *ruleSet) []truffleHogOutput {
+	var findings []truffleHogOutput
+	found := make([][]string, len(set.rules))
+	seen := make([]int, len(set.rules))
+	var hits, candidates []int
+	var random []string
+
+	for i, line := range strings.Split(string(content), "\n") {
+		var matches []string
+		if set.prefilter {
+			hits, candidates = set.candidates(line, i+1, seen, hits, candidates)
+			for _, j := range candidates {
+				for _, match := range set.rules[j].matchLine(line) {
+					found[j] = appendIfMissing(found[j], match)
+					matches = append(matches, match)
+				}
+			}
+		} else {
+			for j := range set.rules {
+				for _, match := range set.rules[j].match(line) {
+					found[j] = appendIfMissing(found[j], match)
+					matches = append(matches, match)
+				}
+			}
+		}
+
+		if set.entropy == nil {
+			continue
+		}
+		for _, word := range set.entropy.find(line) {
+			if !containsSubstring(matches, word) {
+				random = appendIfMissing(random, word)
+			}
+		}
+	}
+
+	for j, r := range set.rules {
+		if len(found[j]) > 0 {
+			findings = append(findings, truffleHogOutput{Path: path, Reason: r.Name, RuleID: r.ID, Severity: r.Severity, StringsFound: found[j]})
+		}
+	}
+	checkPrivateKeys(findings, content)
+	if len(random) > 0 {
+		findings = append(findings, truffleHogOutput{Path: path, Reason: entropyRule.Name, RuleID: entropyRule.ID, Severity: entropyRule.Severity, StringsFound: random})
+	}
+	return findings
+}
+
+func containsSubstring(list []string, s string) bool {
+	for _, item := range list {
+		if strings.Contains(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanTree scans every file below root, reporting paths relative to base
+func scanTree(root string, base string, rules *ruleSet) ([]truffleHogOutput, error) {
+	var findings []truffleHogOutput
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if isArchive(info.Name()) {
+			if info.Size() > int64(*maxArchiveSize)<<20 {
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			findings = append(findings, scanArchive(content, relativePath, rules)...)
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isBinary(content) {
+			return nil
+		}
+		findings = append(findings, scanContent(content, relativePath, rules)...)
+		return nil
+	})
+
+	return findings, err
+}
+
+// writeNativeOutput writes the findings as JSON lines, like truffleHog does with --json
+func writeNativeOutput(findings []truffleHogOutput, outfile string) error {
+	var out bytes.Buffer
+	for _, finding := range findings {
+		line, err := json.Marshal(finding)
+		if err != nil {
+			return err
+		}
+		out.Write(line)
+		out.WriteString("\n")
+	}
+	return ioutil.WriteFile(outfile, out.Bytes(), 0600)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// The repos go through a pipeline: they are enumerated through the API, cloned, scanned as soon
+// as their clone completes and then deleted. The stages are connected by queues as long as the
+// pool of the next stage is large, so enumerating blocks while the clones are behind and cloning
+// blocks while the scans are, and no more than a few repos per worker are on disk at any time.
+
+// repoJob is one repo going through the pipeline. The url is empty for repos already on disk.
+type repoJob struct {
+	url   string
+	path  string
+	name  string
+	owner string
+	wiki  bool
+}
+
+type pipeline struct {
+	clones   chan repoJob
+	scans    chan repoJob
+	cleanups chan repoJob
+
+	cloning  sync.WaitGroup
+	scanning sync.WaitGroup
+	cleaning sync.WaitGroup
+}
+
+// newPipeline starts the stages, which stop taking on repos once their pools are cancelled
+func newPipeline() *pipeline {
+	p := &pipeline{
+		clones:   make(chan repoJob, cap(clonePool.slots)),
+		scans:    make(chan repoJob, cap(scanPool.slots)),
+		cleanups: make(chan repoJob, cap(scanPool.slots)),
+	}
+
+	p.cloning.Add(1)
+	go p.cloneStage()
+	p.scanning.Add(1)
+	go p.scanStage()
+	p.cleaning.Add(1)
+	go p.cleanupStage()
+	return p
+}
+
+// clone queues a repo to be cloned, and then scanned unless downloadOnly is used
+func (p *pipeline) clone(url string, path string, name string, owner string) {
+	fmt.Println(url)
+	summary.enumerated()
+	journal.record(owner+"/"+name, stepEnumerated, "")
+	p.clones <- repoJob{url: url, path: path, name: name, owner: owner}
+}
+
+// cloneWiki queues the wiki of a repo to be cloned like a repo. Wikis that don't exist are not an error,
+// as Github reports a wiki for every repo with the feature turned on, pages or not.
+func (p *pipeline) cloneWiki(url string, path string, name string, owner string) {
+	fmt.Println(url)
+	summary.wikiEnumerated()
+	journal.record(owner+"/"+name, stepEnumerated, "")
+	p.clones <- repoJob{url: url, path: path, name: name, owner: owner, wiki: true}
+}
+
+// scan queues a repo that is already on disk to be scanned
+func (p *pipeline) scan(path string, name string, owner string) {
+	summary.enumerated()
+	journal.record(owner+"/"+name, stepEnumerated, "")
+	p.scans <- repoJob{path: path, name: name, owner: owner}
+}
+
+// collect runs a download of documents through the API next to the pipeline.
+// The documents are then scanned in the scan pool, next to the clones.
+func (p *pipeline) collect(label string, item func(ctx context.Context)) {
+	apiPool.submit(label, item)
+}
+
+func (p *pipeline) cloneStage() {
+	defer p.cloning.Done()
+	for job := range p.clones {
+		job := job
+		clonePool.run(job.url, func(ctx context.Context) {
+			repository := job.owner + "/" + job.name
+			if !*downloadOnly && journal.scannedByAll(repository) {
+				fmt.Println("Skipping " + job.url + " as it was scanned before the run was interrupted")
+				return
+			}
+
+			if journal.has(repository, stepCloned, "") && fileExists(job.path) {
+				// the clone of the interrupted run is still on disk
+				workspace.added(job.path)
+			} else {
+				if *resume {
+					// what is on disk is a clone cut short by the interruption
+					os.RemoveAll(job.path)
+				}
+				err := gitclone(ctx, job.url, job.path, job.wiki)
+				if err != nil {
+					return
+				}
+				journal.record(repository, stepCloned, "")
+				summary.cloned(dirSize(job.path))
+			}
+
+			if !*downloadOnly {
+				p.scans <- job
+			}
+		})
+	}
+	clonePool.wait()
+}
+
+func (p *pipeline) scanStage() {
+	defer p.scanning.Done()
+	for job := range p.scans {
+		job := job
+		scanPool.run(job.owner+"/"+job.name, func(ctx context.Context) {
+			// the clone is deleted even when a scanner fails
+			defer func() { p.cleanups <- job }()
+			runGitTools(ctx, *toolName, job.path+"/", job.name, job.owner)
+			summary.scanned(gitCommitCount(ctx, job.path))
+		})
+	}
+	scanPool.wait()
+}
+
+// cleanupStage deletes the clones once every scanner is done with them
+func (p *pipeline) cleanupStage() {
+	defer p.cleaning.Done()
+	for job := range p.cleanups {
+		if !clonesDisposable() {
+			continue
+		}
+		// the cleanups outlive the scan jobs, so they run under the context of the whole run
+		err := removeClone(scanPool.ctx, job.path+"/", "/tmp/results/"+job.owner+"/"+job.name+"/")
+		if err != nil {
+			fmt.Println("Deleting the clone failed for: " + job.owner + "_" + job.name + ": " + fmt.Sprint(err))
+		}
+		workspace.removed(job.path, err == nil)
+	}
+}
+
+// wait drains the pipeline once every repo has been queued, one stage after the other
+func (p *pipeline) wait() {
+	// the downloads queue scans of their own, so they are done before the scans are waited for
+	apiPool.wait()
+	close(p.clones)
+	p.cloning.Wait()
+	close(p.scans)
+	p.scanning.Wait()
+	close(p.cleanups)
+	p.cleaning.Wait()
+}
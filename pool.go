@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// API calls, clones and scans are limited separately, as they are bound by the rate limit,
+// the network and the CPU. Each runs in a worker pool, with a timeout per job.
+
+type workerPool struct {
+	ctx     context.Context
+	name    string
+	slots   chan struct{}
+	timeout time.Duration
+	jobs    sync.WaitGroup
+}
+
+var (
+	apiPool   *workerPool
+	clonePool *workerPool
+	scanPool  *workerPool
+)
+
+// newWorkerPool makes a pool running up to size jobs at once, which stops starting jobs once ctx
+// is cancelled. A timeout of 0 means no timeout.
+func newWorkerPool(ctx context.Context, name string, size int, timeout time.Duration) *workerPool {
+	return &workerPool{ctx: ctx, name: name, slots: make(chan struct{}, size), timeout: timeout}
+}
+
+// makePools sizes the pools from the flags, threads being the default for each of them
+func makePools(ctx context.Context) {
+	size := func(n int) int {
+		if n > 0 {
+			return n
+		}
+		return *threads
+	}
+	apiPool = newWorkerPool(ctx, "api", size(*apiThreads), *apiTimeout)
+	clonePool = newWorkerPool(ctx, "clone", size(*cloneThreads), 0)
+	scanPool = newWorkerPool(ctx, "scan", size(*scanThreads), 0)
+}
+
+func checkpoolflags() error {
+	if *threads < 1 || *apiThreads < 0 || *cloneThreads < 0 || *scanThreads < 0 {
+		fmt.Println("threads should be at least 1, and apiThreads, cloneThreads and scanThreads can't be negative")
+		os.Exit(2)
+	}
+	if *cloneRetries < 0 {
+		fmt.Println("cloneRetries can't be negative")
+		os.Exit(2)
+	}
+	if *apiTimeout < 0 || *cloneTimeout < 0 || *scanTimeout < 0 {
+		fmt.Println("apiTimeout, cloneTimeout and scanTimeout can't be negative")
+		os.Exit(2)
+	}
+	return nil
+}
+
+// run waits for a free worker and starts the job on it, so the caller is held back while the
+// pool is busy. It returns false without running the job when the pool is cancelled first.
+// Jobs must not call run on their own pool, as all the workers could end up waiting on each other;
+// they can use submit instead.
+func (p *workerPool) run(label string, job func(ctx context.Context)) bool {
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.ctx.Done():
+		return false
+	}
+	if p.ctx.Err() != nil {
+		<-p.slots
+		return false
+	}
+
+	p.jobs.Add(1)
+	go func() {
+		defer p.jobs.Done()
+		defer func() { <-p.slots }()
+		p.execute(label, job)
+	}()
+	return true
+}
+
+// submit queues the job without waiting for a free worker, so it is safe to call from jobs of any pool.
+// The job gets a context of its own, so it outlives the job that submitted it.
+func (p *workerPool) submit(label string, job func(ctx context.Context)) {
+	p.jobs.Add(1)
+	go func() {
+		defer p.jobs.Done()
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+		defer func() { <-p.slots }()
+		if p.ctx.Err() == nil {
+			p.execute(label, job)
+		}
+	}()
+}
+
+// execute runs a job with the timeout of the pool. A job that panics is recorded as failed,
+// as check panics on errors and one repo shouldn't bring down the whole run.
+func (p *workerPool) execute(label string, job func(ctx context.Context)) {
+	ctx := p.ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("The %s job for %s failed: %v\n%s", p.name, label, r, debug.Stack())
+			summary.fail(label, p.name+" job failed: "+fmt.Sprint(r))
+		}
+	}()
+	job(ctx)
+}
+
+// wait waits for the jobs started or submitted so far, along with the jobs they submit
+func (p *workerPool) wait() {
+	p.jobs.Wait()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitOrFail fails the test when the pool doesn't drain within the deadline, as it would on a deadlock
+func waitOrFail(t *testing.T, p *workerPool, deadline time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		p.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(deadline):
+		t.Fatalf("the %s pool didn't drain within %s", p.name, deadline)
+	}
+}
+
+func TestWorkerPoolSubmitFromJobs(t *testing.T) {
+	p := newWorkerPool(context.Background(), "test", 2, 0)
+
+	// every job submits two more to its own pool until the tree is 8 levels deep,
+	// so the pool is full of jobs submitting jobs for most of the run
+	var ran int32
+	var spawn func(level int) func(ctx context.Context)
+	spawn = func(level int) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			atomic.AddInt32(&ran, 1)
+			if level == 8 {
+				return
+			}
+			p.submit("child", spawn(level+1))
+			p.submit("child", spawn(level+1))
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if !p.run("root", spawn(1)) {
+			t.Fatal("run refused a job before the pool was cancelled")
+		}
+	}
+
+	waitOrFail(t, p, 10*time.Second)
+	if want := int32(2 * (1<<8 - 1)); ran != want {
+		t.Errorf("%d jobs ran, want %d", ran, want)
+	}
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newWorkerPool(ctx, "test", 1, 0)
+
+	started := make(chan struct{})
+	var cancelled int32
+	p.run("blocking", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+	})
+	<-started
+
+	var queuedRan int32
+	for i := 0; i < 5; i++ {
+		p.submit("queued", func(ctx context.Context) {
+			atomic.AddInt32(&queuedRan, 1)
+		})
+	}
+	cancel()
+
+	waitOrFail(t, p, 5*time.Second)
+	if cancelled != 1 {
+		t.Error("the running job didn't see the cancellation")
+	}
+	if queuedRan != 0 {
+		t.Errorf("%d queued jobs ran after the pool was cancelled", queuedRan)
+	}
+	if p.run("late", func(ctx context.Context) { t.Error("a job ran after the pool was cancelled") }) {
+		t.Error("run accepted a job after the pool was cancelled")
+	}
+}
+
+func TestWorkerPoolTimeout(t *testing.T) {
+	p := newWorkerPool(context.Background(), "test", 1, 50*time.Millisecond)
+
+	var err error
+	p.run("slow", func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	waitOrFail(t, p, 5*time.Second)
+	if err != context.DeadlineExceeded {
+		t.Errorf("the job ended with %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWorkerPoolPanic(t *testing.T) {
+	saved := summary
+	summary = &runSummary{}
+	defer func() { summary = saved }()
+
+	p := newWorkerPool(context.Background(), "test", 1, 0)
+	p.run("owner/repo", func(ctx context.Context) {
+		panic("something broke")
+	})
+	var ranAfter bool
+	p.run("owner/next", func(ctx context.Context) {
+		ranAfter = true
+	})
+
+	waitOrFail(t, p, 5*time.Second)
+	if len(summary.Failed) != 1 {
+		t.Fatalf("%d jobs recorded as failed, want 1", len(summary.Failed))
+	}
+	if failed := summary.Failed[0]; failed.Job != "owner/repo" || failed.Error != "test job failed: something broke" {
+		t.Errorf("recorded %+v", failed)
+	}
+	if !ranAfter {
+		t.Error("the pool stopped running jobs after one panicked")
+	}
+}
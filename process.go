@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// git and the scanners start processes of their own, like ssh, git-remote-https or node, so each
+// command runs in a process group of its own, which is killed as a whole when it times out.
+
+var (
+	processGroupsMu sync.Mutex
+	processGroups   = make(map[int]bool)
+)
+
+// withTimeout bounds ctx by timeout, a timeout of 0 meaning no timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// startCommand starts a command made with exec.CommandContext in a process group of its own.
+// The returned wait function returns the error of ctx when ctx is done before the command.
+func startCommand(ctx context.Context, cmd *exec.Cmd) (func() error, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	pgid := cmd.Process.Pid
+
+	processGroupsMu.Lock()
+	processGroups[pgid] = true
+	processGroupsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	return func() error {
+		err := cmd.Wait()
+		close(done)
+		processGroupsMu.Lock()
+		delete(processGroups, pgid)
+		processGroupsMu.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}, nil
+}
+
+// runCommand runs a command made with exec.CommandContext in a process group of its own
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	wait, err := startCommand(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+// outputCommand is runCommand returning the standard output of the command, like exec.Cmd.Output
+func outputCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := runCommand(ctx, cmd)
+	return stdout.Bytes(), err
+}
+
+// killProcessGroups kills the commands still running, as they don't get the signals of the terminal
+func killProcessGroups() {
+	processGroupsMu.Lock()
+	defer processGroupsMu.Unlock()
+	for pgid := range processGroups {
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
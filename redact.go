@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// The output file and the merged JSON end up attached to tickets and CI artifacts, so with the
+// redact flag the secrets in them are masked down to their first and last characters.
+// Each redacted secret keeps its fingerprint, so findings can still be matched up with each
+// other and with the secret incidents. The per-repo results in /tmp/results are left as they are.
+
+// redactString masks the middle of a secret, showing up to a quarter of it and at most 4
+// characters on each end, like AKIA****MPLE
+func redactString(secret string) string {
+	runes := []rune(secret)
+	shown := len(runes) / 4
+	if shown > 4 {
+		shown = 4
+	}
+	return string(runes[:shown]) + "****" + string(runes[len(runes)-shown:])
+}
+
+// redactMatch masks the secret inside what a rule matched, leaving the rest of the match readable.
+// Private key headers are not secret and are kept.
+func redactMatch(r rule, match string) string {
+	if header := privateKeyHeader(match); header != "" {
+		if rest := match[len(header):]; rest != "" {
+			return header + redactString(rest)
+		}
+		return header
+	}
+	secret := r.secret(match)
+	return strings.Replace(match, secret, redactString(secret), -1)
+}
+
+func redactMatches(r rule, stringsFound []string) []string {
+	var redacted []string
+	for _, match := range stringsFound {
+		redacted = append(redacted, redactMatch(r, match))
+	}
+	return redacted
+}
+
+// redactScan masks the secrets of one repository in the merged output
+func redactScan(scan *repositoryScan) {
+	for path, stringsFound := range scan.Results {
+		scan.Results[path] = redactMatches(rule{}, stringsFound)
+	}
+	for i := range scan.Findings {
+		r := ruleByName(scan.Findings[i].Rule)
+		scan.Findings[i].StringsFound = redactMatches(r, scan.Findings[i].StringsFound)
+	}
+}
+
+// truffleHogHighlight matches the strings truffleHog's text output highlights in diffs,
+// which are the strings it found, for its regexes as well as for entropy
+var truffleHogHighlight = regexp.MustCompile("\x1b\\[93m(.*?)\x1b\\[0m")
+
+// redactResults copies the results file of a tool like copyResults does, masking the secrets.
+// truffleHog's text output is redacted where it highlights findings, the JSON outputs field by field.
+func redactResults(of io.Writer, file io.Reader, toolname string) error {
+	switch toolname {
+	case "truffleHog":
+		var current rule
+		inKey := false
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			// only the header of a private key is highlighted, so the lines up to its end are masked too
+			if inKey {
+				if strings.Contains(line, "-----END ") {
+					inKey = false
+				} else if len(line) > 1 {
+					line = line[:1] + "****"
+				}
+			} else if strings.Contains(line, "-----BEGIN ") && strings.Contains(line, privateKeyMarker) {
+				inKey = !strings.Contains(line, "-----END ")
+			}
+			if reason := truffleHogReason.FindStringSubmatch(line); reason != nil {
+				current = ruleByName(reason[1])
+				line = strings.Replace(line, reason[0], reason[0]+" (severity: "+current.Severity+")", 1)
+			}
+			line = truffleHogHighlight.ReplaceAllStringFunc(line, func(highlight string) string {
+				match := truffleHogHighlight.FindStringSubmatch(highlight)[1]
+				if fingerprint := fingerprintSecrets(current, []string{match})[0]; fingerprint != "" {
+					return "\x1b[93m" + redactMatch(current, match) + " [" + fingerprint + "]\x1b[0m"
+				}
+				return "\x1b[93m" + redactMatch(current, match) + "\x1b[0m"
+			})
+			if _, err := io.WriteString(of, line+"\n"); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+
+	case "repo-supervisor":
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		var output reposupervisorOutput
+		if err := json.Unmarshal(content, &output); err != nil {
+			return err
+		}
+		redacted := struct {
+			Result       map[string][]string `json:"result"`
+			Fingerprints map[string][]string `json:"fingerprints"`
+		}{make(map[string][]string), make(map[string][]string)}
+		for path, stringsFound := range output.Result {
+			redacted.Result[path] = redactMatches(rule{}, stringsFound)
+			redacted.Fingerprints[path] = fingerprintSecrets(rule{}, stringsFound)
+		}
+		return json.NewEncoder(of).Encode(redacted)
+	}
+
+	// the native scanner and the documents it scans write truffleHog's JSON lines
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(of)
+	for scanner.Scan() {
+		var issue truffleHogOutput
+		if err := json.Unmarshal(scanner.Bytes(), &issue); err != nil {
+			return err
+		}
+		r := ruleByName(issue.Reason)
+		issue.Fingerprints = fingerprintSecrets(r, issue.StringsFound)
+		if len(issue.Keys) > 0 {
+			issue.Fingerprints = fingerprintKeys(issue.Keys)
+		}
+		issue.StringsFound = redactMatches(r, issue.StringsFound)
+		if err := encoder.Encode(issue); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/github"
+)
+
+// collectreleases downloads the notes, assets and source archive of every release of a repo
+// into the documents workspace, as releases/<tag>/notes.md, releases/<tag>/assets/<name> and
+// releases/<tag>/source/. Archives are extracted, other assets are kept as they are.
+func collectreleases(ctx context.Context, client *github.Client, owner string, repo string) error {
+	dir := documentDir(owner, repo, "releases")
+	maxBytes := int64(*maxDownloadSize) << 20
+
+	var releases []*github.RepositoryRelease
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		rels, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opt)
+		if err != nil {
+			return err
+		}
+		releases = append(releases, rels...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	for _, release := range releases {
+		// tag names are chosen by whoever pushed them, so they are treated like archive entries
+		releaseDir, err := safeJoin(dir, release.GetTagName())
+		if err != nil {
+			return err
+		}
+
+		err = writeDocument(releaseDir+"/notes.md", release.GetName()+"\n\n"+release.GetBody())
+		if err != nil {
+			return err
+		}
+
+		for _, asset := range release.Assets {
+			if int64(asset.GetSize()) > maxBytes {
+				fmt.Println("Skipping the asset " + asset.GetName() + " of release " + release.GetTagName() + " of " + owner + "/" + repo + " since it is larger than maxDownloadSize")
+				continue
+			}
+			assetPath, err := safeJoin(releaseDir+"/assets", asset.GetName())
+			if err != nil {
+				return err
+			}
+			err = downloadRelease(ctx, client, asset.GetURL(), asset.GetName(), assetPath, maxBytes)
+			if err != nil {
+				fmt.Println("Skipping the asset " + asset.GetName() + " of release " + release.GetTagName() + " of " + owner + "/" + repo + ": " + fmt.Sprint(err))
+			}
+		}
+
+		if release.GetZipballURL() != "" {
+			err = downloadRelease(ctx, client, release.GetZipballURL(), "source.zip", releaseDir+"/source", maxBytes)
+			if err != nil {
+				fmt.Println("Skipping the source archive of release " + release.GetTagName() + " of " + owner + "/" + repo + ": " + fmt.Sprint(err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// downloadRelease downloads a release file to dest, extracting it into dest instead if it is an archive
+func downloadRelease(ctx context.Context, client *github.Client, urlStr string, name string, dest string, maxBytes int64) error {
+	if !isArchive(name) {
+		return downloadAPIFile(ctx, client, urlStr, "application/octet-stream", dest, maxBytes)
+	}
+
+	archive := dest + ".download"
+	err := downloadAPIFile(ctx, client, urlStr, "application/octet-stream", archive, maxBytes)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+
+	return extractArchive(archive, name, dest, extractLimit())
+}
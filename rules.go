@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A rule describes one kind of secret. rules.json holds either a list of rules in this format,
+// or the flat name to regex map understood by truffleHog, which is loaded with default values.
+type rule struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Pattern     string    `json:"regex"`
+	Severity    string    `json:"severity,omitempty"`
+	Confidence  string    `json:"confidence,omitempty"`
+	Keywords    []string  `json:"keywords,omitempty"`
+	Entropy     float64   `json:"entropy,omitempty"`
+	Allowlist   []string  `json:"allowlist,omitempty"`
+	Remediation string    `json:"remediation,omitempty"`
+	Positives   []string  `json:"positives,omitempty"`
+	Negatives   []string  `json:"negatives,omitempty"`
+	Verify      *verifier `json:"verify,omitempty"`
+
+	Regex     *regexp.Regexp `json:"-"`
+	allowlist []*regexp.Regexp
+}
+
+// severities from the most to the least urgent
+var severities = []string{"critical", "high", "medium", "low", "info"}
+
+const (
+	defaultSeverity   = "medium"
+	defaultConfidence = "medium"
+)
+
+// severityRank orders severities, unknown ones last
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severities)
+}
+
+// parseRules reads either rule format and compiles the rules, sorted by name.
+// It also reports whether the content was in the flat format. Flat rules were written for truffleHog's
+// Python regular expressions, so the ones Go can't compile are left out with a warning instead of failing.
+func parseRules(content []byte) ([]rule, bool, error) {
+	decoded, flat, err := decodeRules(content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var rules []rule
+	ids := make(map[string]bool)
+	for _, r := range decoded {
+		err := r.compile()
+		if err != nil && flat {
+			fmt.Println("The native scanner skips the rule " + r.Name + " as its regular expression is not supported in Go, truffleHog still uses it: " + fmt.Sprint(err))
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if ids[r.ID] {
+			return nil, false, fmt.Errorf("rule id %q is used more than once", r.ID)
+		}
+		ids[r.ID] = true
+		rules = append(rules, r)
+	}
+	sortRules(rules)
+
+	return rules, flat, nil
+}
+
+// decodeRules reads either rule format without compiling the rules
+func decodeRules(content []byte) ([]rule, bool, error) {
+	var rules []rule
+
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err := json.Unmarshal(trimmed, &rules)
+		return rules, false, err
+	}
+
+	var patterns map[string]string
+	err := json.Unmarshal(trimmed, &patterns)
+	if err != nil {
+		return nil, false, err
+	}
+	for name, pattern := range patterns {
+		rules = append(rules, rule{Name: name, Pattern: pattern})
+	}
+	return rules, true, nil
+}
+
+func sortRules(rules []rule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+}
+
+// compile fills in the defaults and compiles the patterns of a rule
+func (r *rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule %q has no name", r.ID)
+	}
+	if r.ID == "" {
+		r.ID = ruleID(r.Name)
+	}
+	if r.Severity == "" {
+		r.Severity = defaultSeverity
+	}
+	if severityRank(r.Severity) == len(severities) {
+		return fmt.Errorf("rule %s has the unknown severity %q, it should be one of %s", r.ID, r.Severity, strings.Join(severities, ", "))
+	}
+	if r.Confidence == "" {
+		r.Confidence = defaultConfidence
+	}
+
+	var err error
+	r.Regex, err = regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("rule %s: %v", r.ID, err)
+	}
+	r.allowlist = nil
+	for _, pattern := range r.Allowlist {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("allowlist of rule %s: %v", r.ID, err)
+		}
+		r.allowlist = append(r.allowlist, re)
+	}
+	if r.Verify != nil {
+		err = r.Verify.compile()
+		if err != nil {
+			return fmt.Errorf("verifier of rule %s: %v", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// ruleID derives an id such as generic-password from a rule name
+func ruleID(name string) string {
+	var id []rune
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			id = append(id, c)
+			dash = false
+		} else if !dash && len(id) > 0 {
+			id = append(id, '-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(string(id), "-")
+}
+
+// match returns the secrets the rule finds in a line. Lines without any of the keywords are
+// skipped, as are matches under the entropy threshold or matching the allowlist.
+// When the regex has a capture group, the first group is the secret the entropy is measured on.
+func (r *rule) match(line string) []string {
+	if len(r.Keywords) > 0 {
+		lower := strings.ToLower(line)
+		found := false
+		for _, keyword := range r.Keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return r.matchLine(line)
+}
+
+// matchLine is match for a line already known to contain one of the keywords
+func (r *rule) matchLine(line string) []string {
+	var matches []string
+	for _, submatches := range r.Regex.FindAllStringSubmatch(line, -1) {
+		match := submatches[0]
+		if r.allowed(match) {
+			continue
+		}
+		if r.Entropy > 0 {
+			secret := match
+			if len(submatches) > 1 && submatches[1] != "" {
+				secret = submatches[1]
+			}
+			if shannonEntropy(secret) < r.Entropy {
+				continue
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func (r *rule) allowed(match string) bool {
+	for _, re := range r.allowlist {
+		if re.MatchString(match) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadRules(path string) ([]rule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, _, err := parseRules(content)
+	return rules, err
+}
+
+// ruleSources are the values of the ruleSource flag
+var ruleSources = []string{"builtin", "file", "both"}
+
+func validRuleSource(source string) bool {
+	for _, s := range ruleSources {
+		if source == s {
+			return true
+		}
+	}
+	return false
+}
+
+func checkruleflags() error {
+	if !validRuleSource(*ruleSource) {
+		fmt.Println("ruleSource should be one of " + strings.Join(ruleSources, ", ") + ". Please provide a valid value or leave it at both")
+		os.Exit(2)
+	} else if *nativeEntropy && !(*toolName == "all" || *toolName == "native") {
+		fmt.Println("nativeEntropy flag should be used only when native is being run. So, either leave the toolName blank or the toolName should be native")
+		os.Exit(2)
+	} else if *entropyBase64 <= 0 || *entropyBase64 > 6 {
+		fmt.Println("entropyBase64 should be more than 0 and at most 6, the entropy of random base64")
+		os.Exit(2)
+	} else if *entropyHex <= 0 || *entropyHex > 4 {
+		fmt.Println("entropyHex should be more than 0 and at most 4, the entropy of random hex")
+		os.Exit(2)
+	} else if *verifyBaseURL != "" && !*verify {
+		fmt.Println("verifyBaseURL flag should be used only along with the verify flag")
+		os.Exit(2)
+	} else if *verifyBaseURL != "" && !(strings.HasPrefix(*verifyBaseURL, "http://") || strings.HasPrefix(*verifyBaseURL, "https://")) {
+		fmt.Println("verifyBaseURL should be an http or https URL. Example: http://localhost:8080")
+		os.Exit(2)
+	} else if *entropyMinLength < 8 {
+		fmt.Println("entropyMinLength should be at least 8, shorter strings are too often random looking by chance")
+		os.Exit(2)
+	} else if *archiveDepth < 0 {
+		fmt.Println("archiveDepth can't be negative. Please provide a number of levels or 0 to not open archives")
+		os.Exit(2)
+	} else if *maxArchiveSize < 1 {
+		fmt.Println("maxArchiveSize should be at least 1 MB")
+		os.Exit(2)
+	}
+	return nil
+}
+
+// loadBuiltinRules compiles a copy of the built-in rule pack, sorted by name like parseRules does
+func loadBuiltinRules() ([]rule, error) {
+	rules := make([]rule, len(builtinRules))
+	copy(rules, builtinRules)
+	for i := range rules {
+		err := rules[i].compile()
+		if err != nil {
+			return nil, fmt.Errorf("built-in %v", err)
+		}
+	}
+	sortRules(rules)
+	return rules, nil
+}
+
+// selectRules returns the rules of the given source. With both, a rule from the rules file
+// replaces the built-in rule with the same id or name, so a user can tune a built-in rule.
+func selectRules(source string, path string) ([]rule, error) {
+	if source == "file" {
+		return loadRules(path)
+	}
+	builtin, err := loadBuiltinRules()
+	if err != nil || source == "builtin" {
+		return builtin, err
+	}
+
+	fileRules, err := loadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRules(fileRules, builtin), nil
+}
+
+// mergeRules adds the built-in rules that no rule from the rules file replaces
+func mergeRules(fileRules []rule, builtin []rule) []rule {
+	rules := fileRules
+	for _, b := range builtin {
+		replaced := false
+		for _, r := range fileRules {
+			if r.ID == b.ID || r.Name == b.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			rules = append(rules, b)
+		}
+	}
+	sortRules(rules)
+	return rules
+}
+
+var (
+	nativeRulesOnce sync.Once
+	nativeRulesList []rule
+	nativeRulesSet  *ruleSet
+	nativeRulesErr  error
+)
+
+// nativeRules loads the rules once for all the repos scanned by the native scanner
+func nativeRules() ([]rule, error) {
+	nativeRulesOnce.Do(func() {
+		nativeRulesList, nativeRulesErr = selectRules(*ruleSource, *rulesFile)
+		nativeRulesSet = newRuleSet(nativeRulesList)
+		if *nativeEntropy {
+			nativeRulesSet.entropy = newEntropyDetector()
+		}
+		if nativeRulesErr == nil && *ruleSource != "file" {
+			fmt.Println("Using the built-in rules version " + builtinRulesVersion)
+		}
+	})
+	return nativeRulesList, nativeRulesErr
+}
+
+// nativeRuleSet is nativeRules ready for scanning
+func nativeRuleSet() (*ruleSet, error) {
+	_, err := nativeRules()
+	return nativeRulesSet, err
+}
+
+// ruleByName finds the rule truffleHog or the native scanner reported a finding for.
+// Findings that come from no rule, like truffleHog's high entropy ones, get the lowest severity.
+func ruleByName(name string) rule {
+	rules, _ := nativeRules()
+	for _, r := range rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return rule{ID: ruleID(name), Name: name, Severity: "low", Confidence: "low"}
+}
+
+const truffleHogRulesPath = "/tmp/truffleHog-rules.json"
+
+var (
+	truffleHogRulesOnce sync.Once
+	truffleHogRulesFile string
+	truffleHogRulesErr  error
+)
+
+// truffleHogRules returns the path of a rules file truffleHog understands
+func truffleHogRules() (string, error) {
+	truffleHogRulesOnce.Do(func() {
+		if *ruleSource == "file" {
+			truffleHogRulesFile, truffleHogRulesErr = flattenRules(*rulesFile)
+			return
+		}
+		rules, err := nativeRules()
+		if err != nil {
+			truffleHogRulesErr = err
+			return
+		}
+		if *ruleSource == "both" {
+			// the flat rules the native scanner skips are still good for truffleHog
+			rules = append(rules, unsupportedFlatRules(*rulesFile, rules)...)
+		}
+		truffleHogRulesFile, truffleHogRulesErr = writeFlatRules(rules)
+	})
+	return truffleHogRulesFile, truffleHogRulesErr
+}
+
+// unsupportedFlatRules lists the rules of a flat rules file that were left out of rules, as Go can't compile them
+func unsupportedFlatRules(path string, rules []rule) []rule {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	decoded, flat, err := decodeRules(content)
+	if err != nil || !flat {
+		return nil
+	}
+
+	var unsupported []rule
+	for _, d := range decoded {
+		included := false
+		for _, r := range rules {
+			if r.Name == d.Name {
+				included = true
+				break
+			}
+		}
+		if !included {
+			unsupported = append(unsupported, d)
+		}
+	}
+	return unsupported
+}
+
+// flattenRules writes rules in the extended format as the flat name to regex map, which is the
+// only format truffleHog knows. Rules already in the flat format are used as they are.
+func flattenRules(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if _, flat, err := decodeRules(content); err != nil || flat {
+		return path, err
+	}
+	rules, _, err := parseRules(content)
+	if err != nil {
+		return "", err
+	}
+	return writeFlatRules(rules)
+}
+
+func writeFlatRules(rules []rule) (string, error) {
+	patterns := make(map[string]string)
+	for _, r := range rules {
+		patterns[r.Name] = r.Pattern
+	}
+	flattened, err := json.MarshalIndent(patterns, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return truffleHogRulesPath, ioutil.WriteFile(truffleHogRulesPath, flattened, 0600)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		flat    bool
+		wantErr bool
+	}{
+		{"extended",
+			`[{"id": "b-token", "name": "B token", "regex": "b_[0-9]+"}, {"name": "A token", "regex": "a_[0-9]+"}]`,
+			[]string{"a-token A token medium", "b-token B token medium"}, false, false},
+		{"extended with leading space",
+			"\n  [{\"name\": \"A token\", \"regex\": \"a_[0-9]+\", \"severity\": \"critical\"}]",
+			[]string{"a-token A token critical"}, false, false},
+		{"flat",
+			`{"B token": "b_[0-9]+", "A token": "a_[0-9]+"}`,
+			[]string{"a-token A token medium", "b-token B token medium"}, true, false},
+		{"flat rules Go can't compile are skipped",
+			`{"A token": "a_[0-9]+", "Lookahead": "(?=x)y"}`,
+			[]string{"a-token A token medium"}, true, false},
+		{"extended rules Go can't compile fail",
+			`[{"name": "Lookahead", "regex": "(?=x)y"}]`,
+			nil, false, true},
+		{"bad allowlist",
+			`[{"name": "A token", "regex": "a_[0-9]+", "allowlist": ["("]}]`,
+			nil, false, true},
+		{"no name",
+			`[{"id": "a-token", "regex": "a_[0-9]+"}]`,
+			nil, false, true},
+		{"unknown severity",
+			`[{"name": "A token", "regex": "a_[0-9]+", "severity": "urgent"}]`,
+			nil, false, true},
+		{"same id twice",
+			`[{"id": "token", "name": "A token", "regex": "a"}, {"id": "token", "name": "B token", "regex": "b"}]`,
+			nil, false, true},
+		{"same id derived twice",
+			`[{"name": "A token", "regex": "a"}, {"name": "A  Token", "regex": "b"}]`,
+			nil, false, true},
+		{"not json",
+			`rules`,
+			nil, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, flat, err := parseRules([]byte(test.content))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got the error %v, want an error: %v", err, test.wantErr)
+			}
+			var got []string
+			for _, r := range rules {
+				got = append(got, r.ID+" "+r.Name+" "+r.Severity)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parsed %q, want %q", got, test.want)
+			}
+			if err == nil && flat != test.flat {
+				t.Errorf("flat is %v, want %v", flat, test.flat)
+			}
+		})
+	}
+}
+
+func TestMergeRules(t *testing.T) {
+	builtin := []rule{
+		{ID: "a-token", Name: "A token", Pattern: "builtin"},
+		{ID: "b-token", Name: "B token", Pattern: "builtin"},
+		{ID: "c-token", Name: "C token", Pattern: "builtin"},
+	}
+	fileRules := []rule{
+		{ID: "a-token", Name: "A token renamed", Pattern: "file"},
+		{ID: "b", Name: "B token", Pattern: "file"},
+		{ID: "d-token", Name: "D token", Pattern: "file"},
+	}
+
+	var got []string
+	for _, r := range mergeRules(fileRules, builtin) {
+		got = append(got, r.ID+" "+r.Pattern)
+	}
+	want := []string{"a-token file", "b file", "c-token builtin", "d-token file"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged %q, want %q", got, want)
+	}
+}
+
+func TestUnsupportedFlatRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"flat", `{"A token": "a_[0-9]+", "Lookahead": "(?=x)y"}`, []string{"Lookahead (?=x)y"}},
+		{"flat, all supported", `{"A token": "a_[0-9]+"}`, nil},
+		{"extended", `[{"name": "A token", "regex": "a_[0-9]+"}]`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTempRules(t, test.content)
+			defer os.Remove(path)
+
+			rules, err := loadRules(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range unsupportedFlatRules(path, rules) {
+				got = append(got, r.Name+" "+r.Pattern)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			// truffleHog gets a flat file as it is, the rules Go can't compile included
+			if test.name == "extended" {
+				return
+			}
+			if flattened, err := flattenRules(path); err != nil || flattened != path {
+				t.Errorf("flattened to %s (%v), want %s", flattened, err, path)
+			}
+		})
+	}
+}
+
+// TestRulesFile runs the fixtures of the rules file shipped next to the built-in rules,
+// which have to replace no built-in rule by accident
+func TestRulesFile(t *testing.T) {
+	rules, err := loadRules("rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtin, err := loadBuiltinRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fileRule := range rules {
+		r := fileRule
+		t.Run(r.Name, func(t *testing.T) {
+			for _, problem := range testRule(&r) {
+				t.Error(problem)
+			}
+			for _, b := range builtin {
+				if r.ID == b.ID || r.Name == b.Name {
+					t.Errorf("rule %s replaces the built-in rule %s", r.ID, b.ID)
+				}
+			}
+		})
+	}
+}
+
+func writeTempRules(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+	"time"
+)
+
+// The rules subcommand works with rules without running a scan:
+//
+//	git-all-secrets rules test -rules rules.json
+//	git-all-secrets rules bench -commits 2000
+//
+// It exits with 1 when a rule fails and with 2 on usage errors.
+
+const rulesUsage = "Usage: git-all-secrets rules test|bench [-rules path] [-ruleSource builtin|file|both]"
+
+func rulescommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "test":
+			return rulestest(args[1:])
+		case "bench":
+			return rulesbench(args[1:])
+		}
+	}
+	fmt.Println(rulesUsage)
+	return 2
+}
+
+// rulesflags declares the flags both rules commands take
+func rulesflags(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet("rules "+name, flag.ContinueOnError)
+	path := fs.String("rules", *rulesFile, "Path to the rules.json file")
+	source := fs.String("ruleSource", "both", "Which rules to use: builtin, file or both")
+	return fs, path, source
+}
+
+func rulestest(args []string) int {
+	fs, path, source := rulesflags("test")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !validRuleSource(*source) {
+		fmt.Println("ruleSource should be one of " + strings.Join(ruleSources, ", "))
+		return 2
+	}
+
+	rules, err := rulesUnderTest(*source, *path)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	failed := 0
+	for i := range rules {
+		problems := testRule(&rules[i])
+		if len(problems) == 0 && len(rules[i].Positives) == 0 {
+			fmt.Printf("warn  %s: no positive examples to test the rule with\n", rules[i].ID)
+			continue
+		}
+		if len(problems) == 0 {
+			fmt.Printf("ok    %s (%d positive, %d negative examples)\n", rules[i].ID, len(rules[i].Positives), len(rules[i].Negatives))
+			continue
+		}
+		failed++
+		for _, problem := range problems {
+			fmt.Printf("FAIL  %s: %s\n", rules[i].ID, problem)
+		}
+	}
+
+	fmt.Printf("\n%d rules tested, %d failed\n", len(rules), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// rulesUnderTest decodes the rules of the given source. Unlike selectRules it doesn't stop
+// at the first invalid pattern, compile errors are reported by testRule instead.
+func rulesUnderTest(source string, path string) ([]rule, error) {
+	var builtin, fileRules []rule
+	if source != "file" {
+		builtin = make([]rule, len(builtinRules))
+		copy(builtin, builtinRules)
+	}
+	if source != "builtin" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileRules, _, err = decodeRules(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid rules file: %v", path, err)
+		}
+	}
+
+	for i := range builtin {
+		builtin[i].compile()
+	}
+	for i := range fileRules {
+		fileRules[i].compile()
+	}
+	return mergeRules(fileRules, builtin), nil
+}
+
+// testRule returns what is wrong with a rule: an invalid or backtracking prone pattern,
+// positive examples it misses and negative examples it matches
+func testRule(r *rule) []string {
+	if err := r.compile(); err != nil {
+		return []string{"invalid rule: " + err.Error()}
+	}
+
+	var problems []string
+	if r.Regex.MatchString("") {
+		problems = append(problems, "the pattern matches an empty string, so it matches every line")
+	}
+	re, err := syntax.Parse(r.Pattern, syntax.Perl)
+	if err == nil && nestedRepeat(re, false, false) {
+		problems = append(problems, "the pattern repeats a repetition, like (a+)+, which backtracks catastrophically in truffleHog")
+	}
+
+	for _, example := range r.Positives {
+		if len(r.match(example)) == 0 {
+			problems = append(problems, fmt.Sprintf("false negative: %q is not matched", example))
+		}
+	}
+	for _, example := range r.Negatives {
+		if matches := r.match(example); len(matches) > 0 {
+			problems = append(problems, fmt.Sprintf("false positive: %q is matched by %q", example, matches[0]))
+		}
+	}
+	return problems
+}
+
+// nestedRepeat reports whether a variable repetition is nested in another one, with at least
+// one of them unbounded. Go's regexp runs in linear time, but truffleHog uses Python's re,
+// where such patterns take exponential time on lines that almost match.
+func nestedRepeat(re *syntax.Regexp, inRepeat bool, inUnbounded bool) bool {
+	unbounded := re.Op == syntax.OpStar || re.Op == syntax.OpPlus || (re.Op == syntax.OpRepeat && re.Max == -1)
+	repeats := unbounded || (re.Op == syntax.OpRepeat && re.Max != re.Min)
+	if repeats && inRepeat && (unbounded || inUnbounded) {
+		return true
+	}
+
+	for _, sub := range re.Sub {
+		if nestedRepeat(sub, inRepeat || repeats, inUnbounded || unbounded) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesbench times the native scanner with and without the keyword prefilter over a synthetic
+// history, made of commits adding ordinary code with the positive examples of the rules planted in it
+func rulesbench(args []string) int {
+	fs, path, source := rulesflags("bench")
+	commits := fs.Int("commits", 2000, "Number of commits in the synthetic history")
+	lines := fs.Int("lines", 200, "Number of lines added by each commit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !validRuleSource(*source) || *commits < 1 || *lines < 1 {
+		fmt.Println(rulesUsage + " [-commits n] [-lines n]")
+		return 2
+	}
+
+	rules, err := selectRules(*source, *path)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	history := syntheticHistory(rules, *commits, *lines)
+	fmt.Printf("Scanning a synthetic history of %d commits, %d lines and %d MB with %d rules\n", *commits, *commits**lines, len(history)>>20, len(rules))
+
+	baseline := newRuleSet(rules)
+	baseline.prefilter = false
+	prefiltered := newRuleSet(rules)
+
+	var results [2][]truffleHogOutput
+	var elapsed [2]time.Duration
+	for i, set := range []*ruleSet{baseline, prefiltered} {
+		start := time.Now()
+		results[i] = parseHistory(context.Background(), bytes.NewReader(history), "", set)
+		elapsed[i] = time.Since(start)
+	}
+
+	fmt.Printf("without prefilter: %s, %d findings\n", elapsed[0], len(results[0]))
+	fmt.Printf("with prefilter:    %s, %d findings\n", elapsed[1], len(results[1]))
+	fmt.Printf("speedup:           %.1fx\n", elapsed[0].Seconds()/elapsed[1].Seconds())
+	if !reflect.DeepEqual(results[0], results[1]) {
+		fmt.Println("The findings differ between the two scans")
+		return 1
+	}
+	return 0
+}
+
+// syntheticHistory writes git log output in the format scanHistory reads
+func syntheticHistory(rules []rule, commits int, lines int) []byte {
+	var examples []string
+	for _, r := range rules {
+		examples = append(examples, r.Positives...)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	words := []string{"config", "request", "handler", "value", "result", "buffer", "client", "index", "count", "token", "user", "path"}
+	var out bytes.Buffer
+	planted := 0
+	for c := 0; c < commits; c++ {
+		fmt.Fprintf(&out, "\x00%040x\x002018-06-01 12:00:00 +0000\x00Change %d\n", c, c)
+		file := fmt.Sprintf("src/%s/%s_%d.go", words[c%len(words)], words[(c/7)%len(words)], c)
+		fmt.Fprintf(&out, "diff --git a/%s b/%s\n--- /dev/null\n+++ b/%s\n@@ -0,0 +1,%d @@\n", file, file, file, lines)
+		for l := 0; l < lines; l++ {
+			if len(examples) > 0 && random.Intn(1000) == 0 {
+				fmt.Fprintf(&out, "+%s\n", examples[planted%len(examples)])
+				planted++
+				continue
+			}
+			a, b := words[random.Intn(len(words))], words[random.Intn(len(words))]
+			fmt.Fprintf(&out, "+\t%s%d := %s.Get(%q, %d) // update the %s\n", a, l, b, a+"-"+b, random.Intn(100000), b)
+		}
+	}
+	return out.Bytes()
+}
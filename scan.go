@@ -1,35 +1,63 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
 type repositoryScan struct {
 	Repository string              `json:"repository"`
 	Results    map[string][]string `json:"stringsFound"`
+	Source     string              `json:"source,omitempty"`
+	Findings   []finding           `json:"findings,omitempty"`
+}
+
+// finding is one rule matching in one path, as reported in the merged output
+type finding struct {
+	Tool         string           `json:"tool"`
+	Path         string           `json:"path"`
+	Rule         string           `json:"rule"`
+	RuleID       string           `json:"ruleId"`
+	Severity     string           `json:"severity"`
+	Confidence   string           `json:"confidence"`
+	CommitHash   string           `json:"commitHash,omitempty"`
+	Refs         []string         `json:"refs,omitempty"`
+	StringsFound []string         `json:"stringsFound"`
+	Remediation  string           `json:"remediation,omitempty"`
+	Verification string           `json:"verification,omitempty"`
+	Keys         []privateKeyInfo `json:"keys,omitempty"`
+	Fingerprints []string         `json:"fingerprints,omitempty"`
 }
 type reposupervisorOutput struct {
 	Result map[string][]string `json:"result"`
 }
 type truffleHogOutput struct {
-	Branch       string   `json:"branch"`
-	Commit       string   `json:"commit"`
-	CommitHash   string   `json:"commitHash"`
-	Date         string   `json:"date"`
-	Diff         string   `json:"diff"`
-	Path         string   `json:"path"`
-	PrintDiff    string   `json:"printDiff"`
-	Reason       string   `json:"reason"`
-	StringsFound []string `json:"stringsFound"`
+	Branch       string           `json:"branch"`
+	Commit       string           `json:"commit"`
+	CommitHash   string           `json:"commitHash"`
+	Date         string           `json:"date"`
+	Diff         string           `json:"diff"`
+	Path         string           `json:"path"`
+	PrintDiff    string           `json:"printDiff"`
+	Reason       string           `json:"reason"`
+	StringsFound []string         `json:"stringsFound"`
+	RuleID       string           `json:"ruleId,omitempty"`
+	Severity     string           `json:"severity,omitempty"`
+	Verification string           `json:"verification,omitempty"`
+	Keys         []privateKeyInfo `json:"keys,omitempty"`
+	Fingerprints []string         `json:"fingerprints,omitempty"`
 }
 
 func fileExists(file string) bool {
@@ -39,17 +67,21 @@ func fileExists(file string) bool {
 	return true
 }
 
-func runTrufflehog(filepath string, reponame string, orgoruser string) error {
+// runTrufflehog runs truffleHog over a repo, telling whether it got through it
+func runTrufflehog(ctx context.Context, filepath string, reponame string, orgoruser string) (bool, error) {
 	outputDir := "/tmp/results/" + orgoruser + "/" + reponame
 	os.MkdirAll(outputDir, 0700)
 	outputFile1 := outputDir + "/" + "truffleHog"
 
 	// open the out file for writing
-	outfile, fileErr := os.OpenFile(outputFile1, os.O_CREATE|os.O_RDWR, 0644)
+	outfile, fileErr := os.OpenFile(outputFile1, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
 	check(fileErr)
 	defer outfile.Close()
 
-	params := []string{filepath, "--rules=/root/truffleHog/rules.json", "--regex"}
+	rules, err := truffleHogRules()
+	check(err)
+
+	params := []string{filepath, "--rules=" + rules, "--regex"}
 	if *mergeOutput {
 		params = append(params, "--json")
 	}
@@ -60,77 +92,174 @@ func runTrufflehog(filepath string, reponame string, orgoruser string) error {
 	} else {
 		params = append(params, "--entropy=False")
 	}
+	// restrict truffleHog to the same commit window that was cloned
+	if *since != "" {
+		if sinceCommit := gitSinceCommit(ctx, filepath, *since); sinceCommit != "" {
+			params = append(params, "--since_commit="+sinceCommit)
+		}
+	} else if *depth > 0 {
+		params = append(params, "--max_depth="+strconv.Itoa(*depth))
+	}
+
+	ctx, cancel := withTimeout(ctx, *scanTimeout)
+	defer cancel()
+
 	start := time.Now()
-	cmd1 = exec.Command("trufflehog", params...)
+	cmd1 = exec.CommandContext(ctx, "trufflehog", params...)
 
 	// direct stdout to the outfile
 	cmd1.Stdout = outfile
 
-	err1 := cmd1.Run()
+	err1 := runCommand(ctx, cmd1)
 	// truffleHog returns an exit code 1 if it finds anything
 	elapsed := time.Since(start)
-	if err1 != nil && err1.Error() != "exit status 1" {
+	if err1 == context.DeadlineExceeded {
+		Info(fmt.Sprintf("truffleHog Scanning timed out after: \t%s\t\t for: %s_%s. Please scan it manually.\n", elapsed, orgoruser, reponame))
+		summary.timeout(orgoruser+"/"+reponame, "truffleHog", *scanTimeout)
+		return false, nil
+	} else if err1 != nil && err1.Error() != "exit status 1" {
 		Info(fmt.Sprintf("truffleHog Scanning failed after: \t%s\t\t for: %s_%s. Please scan it manually.\n", elapsed, orgoruser, reponame))
 		fmt.Println(err1)
-	} else {
-		fmt.Printf("Finished truffleHog Scanning after: \t%s\t\t for: %s_%s\n", elapsed, orgoruser, reponame)
+		return false, nil
 	}
-
-	return nil
+	fmt.Printf("Finished truffleHog Scanning after: \t%s\t\t for: %s_%s\n", elapsed, orgoruser, reponame)
+	return true, nil
 }
 
-func runReposupervisor(filepath string, reponame string, orgoruser string) error {
+// runReposupervisor runs repo-supervisor over a repo, telling whether it got through it
+func runReposupervisor(ctx context.Context, filepath string, reponame string, orgoruser string) (bool, error) {
 	outputDir := "/tmp/results/" + orgoruser + "/" + reponame
 	os.MkdirAll(outputDir, 0700)
 	outputFile3 := outputDir + "/" + "repo-supervisor"
 
-	cmd3 := exec.Command("/root/repo-supervisor/runreposupervisor.sh", filepath, outputFile3)
+	ctx, cancel := withTimeout(ctx, *scanTimeout)
+	defer cancel()
+
+	cmd3 := exec.CommandContext(ctx, "/root/repo-supervisor/runreposupervisor.sh", filepath, outputFile3)
 	var out3 bytes.Buffer
 	cmd3.Stdout = &out3
-	err3 := cmd3.Run()
-	if err3 != nil {
+	err3 := runCommand(ctx, cmd3)
+	if err3 == context.DeadlineExceeded {
+		Info("Repo Supervisor Scanning timed out for: " + orgoruser + "_" + reponame + ". Please scan it manually.")
+		summary.timeout(orgoruser+"/"+reponame, "repo-supervisor", *scanTimeout)
+		return false, nil
+	} else if err3 != nil {
 		Info("Repo Supervisor Scanning failed for: " + orgoruser + "_" + reponame + ". Please scan it manually.")
 		fmt.Println(err3)
-	} else {
-		fmt.Println("Finished Repo Supervisor Scanning for: " + orgoruser + "_" + reponame)
+		return false, nil
 	}
-	return nil
+	fmt.Println("Finished Repo Supervisor Scanning for: " + orgoruser + "_" + reponame)
+	return true, nil
 }
 
-func runGitTools(tool string, filepath string, wg *sync.WaitGroup, reponame string, orgoruser string) {
-	defer wg.Done()
+// runNative runs the native scanner over a repo, telling whether it got through it
+func runNative(ctx context.Context, filepath string, reponame string, orgoruser string) (bool, error) {
+	outputDir := "/tmp/results/" + orgoruser + "/" + reponame
+	os.MkdirAll(outputDir, 0700)
+	outputFile4 := outputDir + "/" + "native"
 
-	switch tool {
-	case "all":
-		err := runTrufflehog(filepath, reponame, orgoruser)
-		check(err)
-		err = runReposupervisor(filepath, reponame, orgoruser)
-		check(err)
+	rules, err := nativeRuleSet()
+	if err != nil {
+		return false, err
+	}
 
-	case "thog":
-		err := runTrufflehog(filepath, reponame, orgoruser)
-		check(err)
+	ctx, cancel := withTimeout(ctx, *scanTimeout)
+	defer cancel()
 
-	case "repo-supervisor":
-		err := runReposupervisor(filepath, reponame, orgoruser)
-		check(err)
+	start := time.Now()
+	findings, err4 := scanHistory(ctx, filepath, rules)
+	if err4 != nil && ctx.Err() == nil {
+		// not a git repo, as can be the case with scanOnly, so there are only the files to go by
+		findings, err4 = scanTree(filepath, filepath, rules)
+	}
+	elapsed := time.Since(start)
+	if ctx.Err() == context.DeadlineExceeded {
+		Info(fmt.Sprintf("Native Scanning timed out after: \t%s\t\t for: %s_%s. Please scan it manually.\n", elapsed, orgoruser, reponame))
+		summary.timeout(orgoruser+"/"+reponame, "native", *scanTimeout)
+		return false, nil
+	}
+	if err4 != nil {
+		Info(fmt.Sprintf("Native Scanning failed after: \t%s\t\t for: %s_%s. Please scan it manually.\n", elapsed, orgoruser, reponame))
+		fmt.Println(err4)
+		return false, nil
 	}
+
+	if *verify {
+		findings = verifyFindings(findings)
+	}
+	err = writeNativeOutput(findings, outputFile4)
+	check(err)
+	fmt.Printf("Finished Native Scanning after: \t%s\t\t for: %s_%s\n", elapsed, orgoruser, reponame)
+	return true, nil
 }
 
-func scanforeachuser(user string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// runGitTools runs the tools over a repo, each of them being given up on after scanTimeout.
+// The tools that got through the repo are recorded in the journal, and skipped when resuming.
+func runGitTools(ctx context.Context, tool string, filepath string, reponame string, orgoruser string) {
+	repository := orgoruser + "/" + reponame
+	for _, name := range scanTools(tool) {
+		if journal.has(repository, stepScanned, name) {
+			fmt.Println("Skipping " + name + " Scanning for: " + orgoruser + "_" + reponame + " as it was done before the run was interrupted")
+			continue
+		}
+
+		var finished bool
+		var err error
+		start := time.Now()
+		switch name {
+		case "truffleHog":
+			finished, err = runTrufflehog(ctx, filepath, reponame, orgoruser)
+		case "repo-supervisor":
+			finished, err = runReposupervisor(ctx, filepath, reponame, orgoruser)
+		case "native":
+			finished, err = runNative(ctx, filepath, reponame, orgoruser)
+		}
+		summary.toolRan(name, time.Since(start))
+		check(err)
+		if finished {
+			journal.record(repository, stepScanned, name)
+		}
+	}
+}
 
-	var wguserrepogist sync.WaitGroup
+// scanforeachuser queues the repos and gists of a user that are already on disk to be scanned
+func scanforeachuser(user string, p *pipeline) {
 	gituserrepos, _ := ioutil.ReadDir("/tmp/repos/users/" + user)
 	for _, f := range gituserrepos {
-		wguserrepogist.Add(1)
-		func(user string, wg *sync.WaitGroup, wguserrepogist *sync.WaitGroup, f os.FileInfo) {
-			enqueueJob(func() {
-				runGitTools(*toolName, "/tmp/repos/users/"+user+"/"+f.Name()+"/", wguserrepogist, f.Name(), user)
-			})
-		}(user, wg, &wguserrepogist, f)
+		p.scan("/tmp/repos/users/"+user+"/"+f.Name(), f.Name(), user)
+	}
+}
+
+// truffleHogReason matches the line of truffleHog's text output naming the rule of a finding
+var truffleHogReason = regexp.MustCompile(`Reason: ([^\x1b\r\n]*)`)
+
+// copyResults copies the results file of a tool into the combined output,
+// adding the severity of the rule to truffleHog's findings since its output has no room for it
+func copyResults(of io.Writer, file io.Reader, toolname string) error {
+	if *redact {
+		return redactResults(of, file, toolname)
+	}
+	if toolname != "truffleHog" {
+		_, err := io.Copy(of, file)
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		line = truffleHogReason.ReplaceAllStringFunc(line, func(reason string) string {
+			return reason + " (severity: " + ruleByName(truffleHogReason.FindStringSubmatch(reason)[1]).Severity + ")"
+		})
+		if _, werr := io.WriteString(of, line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-	wguserrepogist.Wait()
 }
 
 func toolsOutput(toolname string, of *os.File) error {
@@ -147,7 +276,11 @@ func toolsOutput(toolname string, of *os.File) error {
 	for _, user := range users {
 		repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
 		for _, repo := range repos {
-			file, err := os.Open("/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname)
+			resultsPath := "/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname
+			if !fileExists(resultsPath) {
+				continue
+			}
+			file, err := os.Open(resultsPath)
 			check(err)
 
 			fi, err := file.Stat()
@@ -158,11 +291,14 @@ func toolsOutput(toolname string, of *os.File) error {
 			} else if fi.Size() > 0 {
 				orgoruserstr := user.Name()
 				rnamestr := repo.Name()
+				if parent := wikiParent(rnamestr); parent != "" {
+					rnamestr = parent + " (wiki)"
+				}
 
 				_, err1 := of.WriteString("OrgorUser: " + orgoruserstr + " RepoName: " + rnamestr + "\n")
 				check(err1)
 
-				if _, err2 := io.Copy(of, file); err2 != nil {
+				if err2 := copyResults(of, file, toolname); err2 != nil {
 					return err2
 				}
 
@@ -185,7 +321,11 @@ func singletoolOutput(toolname string, of *os.File) error {
 	for _, user := range users {
 		repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
 		for _, repo := range repos {
-			file, err := os.Open("/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname)
+			resultsPath := "/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname
+			if !fileExists(resultsPath) {
+				continue
+			}
+			file, err := os.Open(resultsPath)
 			check(err)
 
 			fi, err := file.Stat()
@@ -195,7 +335,7 @@ func singletoolOutput(toolname string, of *os.File) error {
 				continue
 			} else if fi.Size() > 0 {
 
-				if _, err2 := io.Copy(of, file); err2 != nil {
+				if err2 := copyResults(of, file, toolname); err2 != nil {
 					return err2
 				}
 				of.Sync()
@@ -211,12 +351,12 @@ func combineOutput(toolname string, outputfile string) error {
 	// open a new file and save it in the output directory - outputFile
 	// for each results file, write user/org and reponame, copy results from the file in the outputFile, end with some delimiter
 
-	of, err := os.Create(outputfile)
+	of, err := os.OpenFile(outputfile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	check(err)
 
 	switch toolname {
 	case "all":
-		tools := []string{"truffleHog", "repo-supervisor"}
+		tools := []string{"truffleHog", "repo-supervisor", "native"}
 
 		for _, tool := range tools {
 			err = toolsOutput(tool, of)
@@ -228,6 +368,14 @@ func combineOutput(toolname string, outputfile string) error {
 	case "repo-supervisor":
 		err = singletoolOutput("repo-supervisor", of)
 		check(err)
+	case "native":
+		err = singletoolOutput("native", of)
+		check(err)
+	}
+
+	for _, source := range documentSources {
+		err = toolsOutput(source, of)
+		check(err)
 	}
 
 	defer func() {
@@ -240,48 +388,73 @@ func combineOutput(toolname string, outputfile string) error {
 	return nil
 }
 
-func mergeOutputJSON(outputfile string) {
+func mergeOutputJSON(ctx context.Context, outputfile string) {
 	var results []repositoryScan
-	var basePaths []string
 
-	if *repoURL != "" || *gistURL != "" {
-		basePaths = []string{"/tmp/repos"}
-	} else {
-		basePaths = []string{"/tmp/repos/org", "/tmp/repos/users", "/tmp/repos/team"}
-	}
-
-	for _, basePath := range basePaths {
-		users, _ := ioutil.ReadDir(basePath)
-		for _, user := range users {
-			repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
-			for _, repo := range repos {
-				repoPath := basePath + "/" + user.Name() + "/" + repo.Name() + "/"
-				repoResultsPath := "/tmp/results/" + user.Name() + "/" + repo.Name() + "/"
-				reposupvPath := repoResultsPath + "repo-supervisor"
-				thogPath := repoResultsPath + "truffleHog"
-				reposupvExists := fileExists(reposupvPath)
-				thogExists := fileExists(thogPath)
-				repoURL, _ := gitRepoURL(repoPath)
-
-				var mergedOut map[string][]string
-				if reposupvExists && thogExists {
-					reposupvOut, _ := loadReposupvOut(reposupvPath, repoPath)
-					thogOut, _ := loadThogOutput(thogPath)
-					mergedOut = mergeOutputs(reposupvOut, thogOut)
-				} else if reposupvExists {
-					mergedOut, _ = loadReposupvOut(reposupvPath, repoPath)
-				} else if thogExists {
-					mergedOut, _ = loadThogOutput(thogPath)
+	// the owners are listed from the results, as the clones are deleted once scanned
+	owners, _ := ioutil.ReadDir(resultsDir)
+	for _, owner := range owners {
+		repos, _ := ioutil.ReadDir(resultsDir + owner.Name() + "/")
+		for _, repo := range repos {
+			if !repo.IsDir() {
+				continue
+			}
+			repoResultsPath := resultsDir + owner.Name() + "/" + repo.Name() + "/"
+			info := readRepoInfo(ctx, repoResultsPath, findClone(owner.Name(), repo.Name()))
+			repoPath := info.Path
+			repoURL := info.URL
+			if repoURL == "" {
+				// only the documents of the repo were scanned, it couldn't be cloned
+				repoURL = owner.Name() + "/" + repo.Name()
+			}
+			reposupvPath := repoResultsPath + "repo-supervisor"
+			thogPath := repoResultsPath + "truffleHog"
+			reposupvExists := fileExists(reposupvPath)
+			thogExists := fileExists(thogPath)
+
+			var mergedOut map[string][]string
+			if reposupvExists && thogExists {
+				reposupvOut, _ := loadReposupvOut(reposupvPath, repoPath)
+				thogOut, _ := loadThogOutput(thogPath)
+				mergedOut = mergeOutputs(reposupvOut, thogOut)
+			} else if reposupvExists {
+				mergedOut, _ = loadReposupvOut(reposupvPath, repoPath)
+			} else if thogExists {
+				mergedOut, _ = loadThogOutput(thogPath)
+			}
+			// the native scanner writes the truffleHog format, for the repo as well as for its documents
+			for _, source := range append([]string{"native"}, documentSources...) {
+				if sourcePath := repoResultsPath + source; fileExists(sourcePath) {
+					sourceOut, _ := loadThogOutput(sourcePath)
+					if mergedOut == nil {
+						mergedOut = sourceOut
+					} else {
+						mergedOut = mergeOutputs(sourceOut, mergedOut)
+					}
 				}
-				if len(mergedOut) > 0 {
-					results = append(results, repositoryScan{Repository: repoURL, Results: mergedOut})
+			}
+			if len(mergedOut) > 0 {
+				scan := repositoryScan{Repository: repoURL, Results: mergedOut}
+				if wikiParent(repo.Name()) != "" {
+					// report wiki findings under the repository the wiki belongs to
+					scan.Repository = strings.TrimSuffix(strings.TrimSuffix(repoURL, ".git"), wikiSuffix) + ".git"
+					scan.Source = "wiki"
 				}
+				scan.Findings = loadFindings(repoResultsPath, repoPath, info.Refs)
+				results = append(results, scan)
 			}
 		}
 	}
+	writeIncidents(results, *incidentsOutput)
+
+	if *redact {
+		for i := range results {
+			redactScan(&results[i])
+		}
+	}
 	marshalledResults, err := json.Marshal(results)
 	check(err)
-	err = ioutil.WriteFile(outputfile, marshalledResults, 0644)
+	err = ioutil.WriteFile(outputfile, marshalledResults, 0600)
 	check(err)
 }
 
@@ -294,8 +467,7 @@ func appendIfMissing(slice []string, i string) []string {
 	return append(slice, i)
 }
 
-func loadThogOutput(outfile string) (map[string][]string, error) {
-	results := make(map[string][]string)
+func readThogOutput(outfile string) ([]truffleHogOutput, error) {
 	output, err := ioutil.ReadFile(outfile)
 	if err != nil {
 		return nil, err
@@ -304,6 +476,7 @@ func loadThogOutput(outfile string) (map[string][]string, error) {
 	// There was an issue concerning truffleHog's output not being valid JSON
 	// https://github.com/dxa4481/truffleHog/issues/95
 	// but apparently it was closed without a fix.
+	var issues []truffleHogOutput
 	entries := strings.Split(string(output), "\n")
 	for _, entry := range entries[:len(entries)-1] {
 		var issue truffleHogOutput
@@ -311,6 +484,19 @@ func loadThogOutput(outfile string) (map[string][]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func loadThogOutput(outfile string) (map[string][]string, error) {
+	results := make(map[string][]string)
+	issues, err := readThogOutput(outfile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issue := range issues {
 		if _, found := results[issue.Path]; found {
 			for _, str := range issue.StringsFound {
 				results[issue.Path] = appendIfMissing(results[issue.Path], str)
@@ -323,6 +509,120 @@ func loadThogOutput(outfile string) (map[string][]string, error) {
 	return results, nil
 }
 
+// loadRefs maps the commits with findings in a repo to the refs they are reachable from
+func loadRefs(ctx context.Context, repoResultsPath string, repoPath string) map[string][]string {
+	var refs map[string][]string
+	for _, path := range []string{repoResultsPath + "truffleHog", repoResultsPath + "native"} {
+		issues, err := readThogOutput(path)
+		if err != nil {
+			continue
+		}
+		if refs == nil {
+			refs = make(map[string][]string)
+		}
+		for _, issue := range issues {
+			if issue.CommitHash == "" {
+				continue
+			}
+			if _, found := refs[issue.CommitHash]; !found {
+				refs[issue.CommitHash], _ = gitRefsContaining(ctx, repoPath, issue.CommitHash)
+			}
+		}
+	}
+	return refs
+}
+
+// findingKey tells matches apart regardless of the tool, as truffleHog and native run the same rules over the same commits
+type findingKey struct {
+	path   string
+	commit string
+	rule   string
+}
+
+// findingTools lists the results files in the truffleHog format, native first so that its findings are the ones
+// kept when truffleHog reports the same matches, as native parses private keys and opens archives
+func findingTools() []string {
+	return append([]string{"native", "truffleHog"}, documentSources...)
+}
+
+// loadFindings gathers the findings of all the tools for one repo, the most severe first.
+// refs maps the commits of the findings to the refs they are reachable from, when allRefs is used.
+func loadFindings(repoResultsPath string, repoPath string, refs map[string][]string) []finding {
+	var findings []finding
+	seen := make(map[findingKey]bool)
+
+	for _, tool := range findingTools() {
+		issues, err := readThogOutput(repoResultsPath + tool)
+		if err != nil {
+			continue
+		}
+		if tool == "truffleHog" {
+			checkThogPrivateKeys(issues)
+		}
+		for _, issue := range issues {
+			r := ruleByName(issue.Reason)
+			key := findingKey{path: issue.Path, commit: issue.CommitHash, rule: r.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if issue.Verification == "" && *verify {
+				issue.Verification = verifySecrets(r, issue.StringsFound)
+			}
+			// the native scanner adjusts severities, such as for private keys that don't parse
+			severity := r.Severity
+			if issue.Severity != "" {
+				severity = issue.Severity
+			}
+			fingerprints := fingerprintSecrets(r, issue.StringsFound)
+			if len(issue.Keys) > 0 {
+				fingerprints = fingerprintKeys(issue.Keys)
+			}
+			findings = append(findings, finding{
+				Tool:         tool,
+				Path:         issue.Path,
+				Rule:         r.Name,
+				RuleID:       r.ID,
+				Severity:     severity,
+				Confidence:   r.Confidence,
+				CommitHash:   issue.CommitHash,
+				Refs:         refs[issue.CommitHash],
+				StringsFound: issue.StringsFound,
+				Remediation:  r.Remediation,
+				Verification: issue.Verification,
+				Keys:         issue.Keys,
+				Fingerprints: fingerprints,
+			})
+		}
+	}
+
+	// repo-supervisor only looks for high entropy strings
+	reposupvOut, err := loadReposupvOut(repoResultsPath+"repo-supervisor", repoPath)
+	if err == nil {
+		r := ruleByName("High Entropy")
+		for path, stringsFound := range reposupvOut {
+			findings = append(findings, finding{
+				Tool:         "repo-supervisor",
+				Path:         path,
+				Rule:         r.Name,
+				RuleID:       r.ID,
+				Severity:     r.Severity,
+				Confidence:   r.Confidence,
+				StringsFound: stringsFound,
+				Fingerprints: fingerprintSecrets(r, stringsFound),
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityRank(findings[i].Severity) < severityRank(findings[j].Severity)
+		}
+		return findings[i].Path < findings[j].Path
+	})
+	return findings
+}
+
 func loadReposupvOut(outfile string, home string) (map[string][]string, error) {
 	results := make(map[string][]string)
 	output, err := ioutil.ReadFile(outfile)
@@ -345,7 +645,10 @@ func loadReposupvOut(outfile string, home string) (map[string][]string, error) {
 func mergeOutputs(outputA map[string][]string, outputB map[string][]string) map[string][]string {
 	for path, stringsFound := range outputA {
 		if _, included := outputB[path]; included {
-			outputB[path] = append(outputB[path], stringsFound...)
+			// the tools often find the same strings
+			for _, str := range stringsFound {
+				outputB[path] = appendIfMissing(outputB[path], str)
+			}
 		} else {
 			outputB[path] = stringsFound
 		}
@@ -354,32 +657,18 @@ func mergeOutputs(outputA map[string][]string, outputB map[string][]string) map[
 	return outputB
 }
 
-// Moving directory scanning logic out of individual functions
-func scanDir(dir string, org string) error {
-	var wg sync.WaitGroup
-
+// scanDir queues the repos of a directory that are already on disk to be scanned
+func scanDir(dir string, org string, p *pipeline) {
 	allRepos, _ := ioutil.ReadDir(dir)
 	for _, f := range allRepos {
-		wg.Add(1)
-		func(f os.FileInfo, wg *sync.WaitGroup, org string) {
-			enqueueJob(func() {
-				runGitTools(*toolName, dir+f.Name()+"/", wg, f.Name(), org)
-			})
-		}(f, &wg, org)
-
+		p.scan(dir+f.Name(), f.Name(), org)
 	}
-	wg.Wait()
-	return nil
 }
 
-func scanorgrepos(org string) error {
-	err := scanDir("/tmp/repos/org/"+org+"/", org)
-	check(err)
-	return nil
+func scanorgrepos(org string, p *pipeline) {
+	scanDir("/tmp/repos/org/"+org+"/", org, p)
 }
 
-func scanTeamRepos(org string) error {
-	err := scanDir("/tmp/repos/team/", org)
-	check(err)
-	return nil
+func scanTeamRepos(org string, p *pipeline) {
+	scanDir("/tmp/repos/team/", org, p)
 }
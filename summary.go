@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type skippedRepo struct {
+	Repository string `json:"repository"`
+	Reason     string `json:"reason"`
+}
+
+type timedOutRepo struct {
+	Repository string `json:"repository"`
+	Stage      string `json:"stage"`
+	Timeout    string `json:"timeout"`
+}
+
+type notClonedRepo struct {
+	Repository string `json:"repository"`
+	Reason     string `json:"reason"`
+	Error      string `json:"error"`
+}
+
+type failedJob struct {
+	Job   string `json:"job"`
+	Error string `json:"error"`
+}
+
+// toolRun is the time a tool spent scanning, summed over the repos it scanned
+type toolRun struct {
+	Repos    int    `json:"repos"`
+	Duration string `json:"duration"`
+	elapsed  time.Duration
+}
+
+type runSummary struct {
+	mu      sync.Mutex
+	started time.Time
+
+	WallTime           string              `json:"wallTime"`
+	ReposEnumerated    int                 `json:"reposEnumerated"`
+	WikisEnumerated    int                 `json:"wikisEnumerated"`
+	ReposSkipped       int                 `json:"reposSkipped"`
+	ReposCloned        int                 `json:"reposCloned"`
+	ReposFailed        int                 `json:"reposFailed"`
+	ReposScanned       int                 `json:"reposScanned"`
+	BytesCloned        int64               `json:"bytesCloned"`
+	CommitsScanned     int                 `json:"commitsScanned"`
+	Findings           int                 `json:"findings"`
+	FindingsByRule     map[string]int      `json:"findingsByRule"`
+	FindingsBySeverity map[string]int      `json:"findingsBySeverity"`
+	Tools              map[string]*toolRun `json:"tools"`
+	APICalls           int                 `json:"apiCalls"`
+	RateLimitRemaining *int                `json:"rateLimitRemaining,omitempty"`
+
+	Skipped   []skippedRepo   `json:"skipped"`
+	NotCloned []notClonedRepo `json:"notCloned"`
+	TimedOut  []timedOutRepo  `json:"timedOut"`
+	Failed    []failedJob     `json:"failed"`
+}
+
+var summary = &runSummary{
+	started:            time.Now(),
+	FindingsByRule:     make(map[string]int),
+	FindingsBySeverity: make(map[string]int),
+	Tools:              make(map[string]*toolRun),
+}
+
+// enumerated counts a repo listed through the API or found on disk, whether it is skipped or not
+func (s *runSummary) enumerated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ReposEnumerated++
+}
+
+// wikiEnumerated counts the wiki of a repo, which may have no pages
+func (s *runSummary) wikiEnumerated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.WikisEnumerated++
+}
+
+// cloned counts a repo cloned along with its size on disk
+func (s *runSummary) cloned(bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ReposCloned++
+	s.BytesCloned += bytes
+}
+
+// scanned counts a repo gone through the scanners along with the commits in it
+func (s *runSummary) scanned(commits int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ReposScanned++
+	s.CommitsScanned += commits
+}
+
+// toolRan adds the time a tool spent on a repo, whether it got through it or not
+func (s *runSummary) toolRan(tool string, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, found := s.Tools[tool]
+	if !found {
+		run = &toolRun{}
+		s.Tools[tool] = run
+	}
+	run.Repos++
+	run.elapsed += elapsed
+}
+
+// apiCall counts a call made to the API, keeping track of the rate limit left
+func (s *runSummary) apiCall(resp *http.Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.APICalls++
+	if resp == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		s.RateLimitRemaining = &remaining
+	}
+}
+
+func (s *runSummary) skip(repository string, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Skipped = append(s.Skipped, skippedRepo{Repository: repository, Reason: reason})
+}
+
+// notCloned records a repo that couldn't be cloned, retries included
+func (s *runSummary) notCloned(repository string, reason string, err string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NotCloned = append(s.NotCloned, notClonedRepo{Repository: repository, Reason: reason, Error: err})
+}
+
+// timeout records a repo that a stage, the clone or one of the tools, gave up on
+func (s *runSummary) timeout(repository string, stage string, after time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.TimedOut = append(s.TimedOut, timedOutRepo{Repository: repository, Stage: stage, Timeout: after.String()})
+}
+
+func (s *runSummary) fail(job string, err string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failed = append(s.Failed, failedJob{Job: job, Error: err})
+}
+
+// countFindings counts the findings in the results of every repo, before they are shredded or encrypted.
+// The matches reported by both truffleHog and native are counted once, like in the merged output.
+func (s *runSummary) countFindings() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owners, _ := ioutil.ReadDir(resultsDir)
+	for _, owner := range owners {
+		repos, _ := ioutil.ReadDir(resultsDir + owner.Name() + "/")
+		for _, repo := range repos {
+			repoResultsPath := resultsDir + owner.Name() + "/" + repo.Name() + "/"
+			seen := make(map[findingKey]bool)
+			count := func(issue truffleHogOutput) {
+				r := ruleByName(issue.Reason)
+				key := findingKey{path: issue.Path, commit: issue.CommitHash, rule: r.Name}
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+
+				severity := r.Severity
+				if issue.Severity != "" {
+					severity = issue.Severity
+				}
+				s.Findings++
+				s.FindingsByRule[r.Name]++
+				s.FindingsBySeverity[severity]++
+			}
+
+			for _, tool := range findingTools() {
+				var issues []truffleHogOutput
+				if tool == "truffleHog" && !*mergeOutput {
+					issues = readThogText(repoResultsPath + tool)
+				} else {
+					issues, _ = readThogOutput(repoResultsPath + tool)
+				}
+				if tool == "truffleHog" {
+					checkThogPrivateKeys(issues)
+				}
+				for _, issue := range issues {
+					count(issue)
+				}
+			}
+
+			reposupvOut, err := loadReposupvOut(repoResultsPath+"repo-supervisor", "")
+			if err == nil {
+				for path := range reposupvOut {
+					count(truffleHogOutput{Path: path, Reason: "High Entropy"})
+				}
+			}
+		}
+	}
+}
+
+// truffleHogField matches the lines of truffleHog's text output describing a finding
+var truffleHogField = regexp.MustCompile(`^(?:\x1b\[[0-9;]*m)?(Reason|Hash|Filepath): ([^\x1b\r\n]*)`)
+
+// readThogText reads the rule, commit and path of the findings in a results file of truffleHog in the text format.
+// Each finding starts with its rule, followed by the other fields and then the diff.
+func readThogText(path string) []truffleHogOutput {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var issues []truffleHogOutput
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		field := truffleHogField.FindStringSubmatch(scanner.Text())
+		if field == nil {
+			continue
+		}
+		value := strings.TrimSpace(field[2])
+		if field[1] == "Reason" {
+			issues = append(issues, truffleHogOutput{Reason: value})
+			continue
+		}
+		if len(issues) == 0 {
+			continue
+		}
+		// only the fields right after the rule, the diff can contain anything
+		issue := &issues[len(issues)-1]
+		if field[1] == "Hash" && issue.CommitHash == "" {
+			issue.CommitHash = value
+		} else if field[1] == "Filepath" && issue.Path == "" {
+			issue.Path = value
+		}
+	}
+	return issues
+}
+
+// finish stops the clock and works out the totals, once everything is done
+func (s *runSummary) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.WallTime = time.Since(s.started).Round(time.Second).String()
+	for _, run := range s.Tools {
+		run.Duration = run.elapsed.Round(time.Second).String()
+	}
+	s.ReposSkipped = len(s.Skipped)
+	s.ReposFailed = len(s.NotCloned)
+	for _, timedOut := range s.TimedOut {
+		if timedOut.Stage == "clone" {
+			s.ReposFailed++
+		}
+	}
+}
+
+// write saves the summary as JSON
+func (s *runSummary) write(outputfile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputfile, content, 0600)
+}
+
+func (s *runSummary) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	Info("Run summary\n")
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Wall time\t%s\n", s.WallTime)
+	fmt.Fprintf(table, "Repos enumerated\t%d\n", s.ReposEnumerated)
+	if s.WikisEnumerated > 0 {
+		fmt.Fprintf(table, "Wikis enumerated\t%d\n", s.WikisEnumerated)
+	}
+	fmt.Fprintf(table, "Repos skipped\t%d\n", s.ReposSkipped)
+	fmt.Fprintf(table, "Repos cloned\t%d\n", s.ReposCloned)
+	fmt.Fprintf(table, "Repos failed to clone\t%d\n", s.ReposFailed)
+	fmt.Fprintf(table, "Repos scanned\t%d\n", s.ReposScanned)
+	fmt.Fprintf(table, "Bytes cloned\t%d\n", s.BytesCloned)
+	fmt.Fprintf(table, "Commits scanned\t%d\n", s.CommitsScanned)
+	fmt.Fprintf(table, "API calls\t%d\n", s.APICalls)
+	if s.RateLimitRemaining != nil {
+		fmt.Fprintf(table, "API rate limit remaining\t%d\n", *s.RateLimitRemaining)
+	}
+	table.Flush()
+
+	fmt.Println()
+	table = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Tool\tRepos\tDuration\n")
+	tools := make([]string, 0, len(s.Tools))
+	for tool := range s.Tools {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		fmt.Fprintf(table, "%s\t%d\t%s\n", tool, s.Tools[tool].Repos, s.Tools[tool].Duration)
+	}
+	table.Flush()
+
+	fmt.Println()
+	table = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Severity\tFindings\n")
+	for _, severity := range severities {
+		if s.FindingsBySeverity[severity] > 0 {
+			fmt.Fprintf(table, "%s\t%d\n", severity, s.FindingsBySeverity[severity])
+		}
+	}
+	fmt.Fprintf(table, "total\t%d\n", s.Findings)
+	table.Flush()
+
+	fmt.Println()
+	table = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Rule\tFindings\n")
+	rules := make([]string, 0, len(s.FindingsByRule))
+	for rule := range s.FindingsByRule {
+		rules = append(rules, rule)
+	}
+	// the rules with the most findings first
+	sort.Slice(rules, func(i, j int) bool {
+		if s.FindingsByRule[rules[i]] != s.FindingsByRule[rules[j]] {
+			return s.FindingsByRule[rules[i]] > s.FindingsByRule[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	for _, name := range rules {
+		fmt.Fprintf(table, "%s\t%d\n", name, s.FindingsByRule[name])
+	}
+	table.Flush()
+
+	fmt.Println()
+	fmt.Printf("Repos skipped: %d\n", len(s.Skipped))
+	for _, skipped := range s.Skipped {
+		fmt.Printf("\t%s\t%s\n", skipped.Repository, skipped.Reason)
+	}
+	fmt.Printf("Repos not cloned: %d\n", len(s.NotCloned))
+	for _, notCloned := range s.NotCloned {
+		fmt.Printf("\t%s\t%s error: %s\n", notCloned.Repository, notCloned.Reason, notCloned.Error)
+	}
+	fmt.Printf("Repos timed out: %d\n", len(s.TimedOut))
+	for _, timedOut := range s.TimedOut {
+		fmt.Printf("\t%s\t%s timed out after %s\n", timedOut.Repository, timedOut.Stage, timedOut.Timeout)
+	}
+	fmt.Printf("Jobs failed: %d\n", len(s.Failed))
+	for _, failed := range s.Failed {
+		fmt.Printf("\t%s\t%s\n", failed.Job, failed.Error)
+	}
+}
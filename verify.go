@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Verification results, from the most to the least conclusive
+const (
+	verified   = "verified"
+	invalid    = "invalid"
+	unverified = "unknown"
+)
+
+// A verifier describes the API call that tells whether a secret found by a rule is live.
+// The url, headers and body are templates, with .Secret for the secret and .BaseURL for the
+// base URL, which the verifyBaseURL flag can point at a local server.
+type verifier struct {
+	Method        string            `json:"method,omitempty"`
+	BaseURL       string            `json:"baseUrl"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	Status        []int             `json:"status,omitempty"`
+	BodyMatch     string            `json:"bodyMatch,omitempty"`
+	InvalidStatus []int             `json:"invalidStatus,omitempty"`
+
+	url       *template.Template
+	headers   map[string]*template.Template
+	body      *template.Template
+	bodyMatch *regexp.Regexp
+}
+
+// verifierFuncs are the functions of the verifier templates, on top of the built-in ones such as urlquery.
+// Secrets going into the url are escaped with pathescape or urlquery, as they can hold / or ? or &.
+var verifierFuncs = template.FuncMap{
+	"base64":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"pathescape": url.PathEscape,
+}
+
+// compile fills in the defaults and parses the templates of a verifier
+func (v *verifier) compile() error {
+	if v.URL == "" {
+		return fmt.Errorf("the verifier has no url")
+	}
+	if v.Method == "" {
+		v.Method = "GET"
+	}
+	if len(v.Status) == 0 {
+		v.Status = []int{http.StatusOK}
+	}
+	if len(v.InvalidStatus) == 0 {
+		v.InvalidStatus = []int{http.StatusUnauthorized, http.StatusForbidden}
+	}
+
+	var err error
+	v.url, err = template.New("url").Funcs(verifierFuncs).Parse(v.URL)
+	if err != nil {
+		return err
+	}
+	v.headers = make(map[string]*template.Template)
+	for name, value := range v.Headers {
+		v.headers[name], err = template.New(name).Funcs(verifierFuncs).Parse(value)
+		if err != nil {
+			return err
+		}
+	}
+	v.body, err = template.New("body").Funcs(verifierFuncs).Parse(v.Body)
+	if err != nil {
+		return err
+	}
+	if v.BodyMatch != "" {
+		v.bodyMatch, err = regexp.Compile(v.BodyMatch)
+	}
+	return err
+}
+
+type verifierData struct {
+	Secret  string
+	BaseURL string
+}
+
+func execute(t *template.Template, data verifierData) (string, error) {
+	var out bytes.Buffer
+	err := t.Execute(&out, data)
+	return out.String(), err
+}
+
+var verifyClient = &http.Client{Timeout: 15 * time.Second}
+
+// verify calls the API with the secret. Answers other than the expected and the invalid
+// statuses, such as rate limiting, and network errors leave the secret unknown.
+func (v *verifier) verify(secret string) string {
+	data := verifierData{Secret: secret, BaseURL: strings.TrimSuffix(v.BaseURL, "/")}
+	if *verifyBaseURL != "" {
+		data.BaseURL = strings.TrimSuffix(*verifyBaseURL, "/")
+	}
+
+	url, err := execute(v.url, data)
+	if err != nil {
+		return unverified
+	}
+	body, err := execute(v.body, data)
+	if err != nil {
+		return unverified
+	}
+	req, err := http.NewRequest(v.Method, url, strings.NewReader(body))
+	if err != nil {
+		return unverified
+	}
+	for name, header := range v.headers {
+		value, err := execute(header, data)
+		if err != nil {
+			return unverified
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := verifyClient.Do(req)
+	if err != nil {
+		return unverified
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	for _, status := range v.Status {
+		if resp.StatusCode == status {
+			if v.bodyMatch != nil && !v.bodyMatch.Match(respBody) {
+				return invalid
+			}
+			return verified
+		}
+	}
+	for _, status := range v.InvalidStatus {
+		if resp.StatusCode == status {
+			return invalid
+		}
+	}
+	return unverified
+}
+
+var (
+	verifyCacheMu sync.Mutex
+	verifyCache   = make(map[string]string)
+)
+
+// verifySecrets verifies the secrets a rule found, calling the API once per secret for the whole run.
+// The result is verified if one of the secrets is, then unknown if one of them is, and invalid otherwise.
+func verifySecrets(r rule, stringsFound []string) string {
+	if r.Verify == nil || r.Regex == nil {
+		return ""
+	}
+
+	result := invalid
+	for _, match := range stringsFound {
+		secret := r.secret(match)
+		key := r.ID + "\x00" + secret
+
+		verifyCacheMu.Lock()
+		status, ok := verifyCache[key]
+		verifyCacheMu.Unlock()
+		if !ok {
+			status = r.Verify.verify(secret)
+			verifyCacheMu.Lock()
+			verifyCache[key] = status
+			verifyCacheMu.Unlock()
+		}
+
+		if status == verified {
+			return verified
+		}
+		if status == unverified {
+			result = unverified
+		}
+	}
+	return result
+}
+
+// verifyFindings records on the findings of the native scanner whether their secrets are live
+func verifyFindings(findings []truffleHogOutput) []truffleHogOutput {
+	for i := range findings {
+		r := ruleByName(findings[i].Reason)
+		findings[i].Verification = verifySecrets(r, findings[i].StringsFound)
+	}
+	return findings
+}
+
+// secret extracts the secret from a match, which is the first capture group when the regex has one
+func (r *rule) secret(match string) string {
+	if r.Regex == nil {
+		return match
+	}
+	submatches := r.Regex.FindStringSubmatch(match)
+	if len(submatches) > 1 && submatches[1] != "" {
+		return submatches[1]
+	}
+	return match
+}
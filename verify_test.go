@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// verifyServer answers the verifier calls with the status and body of the path it is called on,
+// and records the last request it got
+type verifyServer struct {
+	*httptest.Server
+	last  *http.Request
+	body  string
+	calls int32
+}
+
+func newVerifyServer() *verifyServer {
+	s := &verifyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		s.last, s.body = r, string(body)
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(`{"ok": true}`))
+		case "/not-ok":
+			w.Write([]byte(`{"ok": false}`))
+		case "/unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		case "/rate-limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(r.URL.EscapedPath()))
+		}
+	}))
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	server := newVerifyServer()
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		verifier verifier
+		want     string
+	}{
+		{"verified", verifier{URL: "{{.BaseURL}}/ok"}, verified},
+		{"invalid", verifier{URL: "{{.BaseURL}}/unauthorized"}, invalid},
+		{"unknown status", verifier{URL: "{{.BaseURL}}/rate-limited"}, unverified},
+		{"custom invalid status", verifier{URL: "{{.BaseURL}}/not-found", InvalidStatus: []int{404}}, invalid},
+		{"not found is unknown by default", verifier{URL: "{{.BaseURL}}/not-found"}, unverified},
+		{"body matches", verifier{URL: "{{.BaseURL}}/ok", BodyMatch: `"ok":\s*true`}, verified},
+		{"body doesn't match", verifier{URL: "{{.BaseURL}}/not-ok", BodyMatch: `"ok":\s*true`}, invalid},
+		{"no server", verifier{URL: "http://127.0.0.1:1/ok"}, unverified},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := test.verifier
+			v.BaseURL = server.URL
+			if err := v.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := v.verify("secret"); got != test.want {
+				t.Errorf("verify() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	server := newVerifyServer()
+	defer server.Close()
+
+	v := verifier{
+		Method:  "POST",
+		BaseURL: server.URL + "/",
+		URL:     "{{.BaseURL}}/bot{{pathescape .Secret}}/check?token={{urlquery .Secret}}",
+		Headers: map[string]string{"Authorization": `Basic {{base64 (print "api:" .Secret)}}`},
+		Body:    `{"token": "{{.Secret}}"}`,
+	}
+	if err := v.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.verify("a/b?c&d"); got != verified {
+		t.Fatalf("verify() = %q, want %q", got, verified)
+	}
+
+	req := server.last
+	if req.Method != "POST" {
+		t.Errorf("method %s, want POST", req.Method)
+	}
+	if got, want := req.URL.EscapedPath(), "/bota%2Fb%3Fc&d/check"; got != want {
+		t.Errorf("path %s, want %s", got, want)
+	}
+	if got := req.URL.Query().Get("token"); got != "a/b?c&d" {
+		t.Errorf("token query parameter %q, want %q", got, "a/b?c&d")
+	}
+	if got, want := req.Header.Get("Authorization"), "Basic YXBpOmEvYj9jJmQ="; got != want {
+		t.Errorf("Authorization header %q, want %q", got, want)
+	}
+	if got, want := server.body, `{"token": "a/b?c&d"}`; got != want {
+		t.Errorf("body %q, want %q", got, want)
+	}
+}
+
+func TestVerifyBaseURL(t *testing.T) {
+	server := newVerifyServer()
+	defer server.Close()
+	saved := *verifyBaseURL
+	defer func() { *verifyBaseURL = saved }()
+	*verifyBaseURL = server.URL + "/"
+
+	v := verifier{BaseURL: "https://api.example.invalid", URL: "{{.BaseURL}}/ok"}
+	if err := v.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.verify("secret"); got != verified {
+		t.Errorf("verify() = %q, want %q, the call should go to verifyBaseURL", got, verified)
+	}
+}
+
+func TestVerifySecrets(t *testing.T) {
+	server := newVerifyServer()
+	defer server.Close()
+
+	r := rule{
+		ID:      "test-verify-secrets",
+		Name:    "Test token",
+		Pattern: `token=(tok_[a-z]+)`,
+		Verify:  &verifier{BaseURL: server.URL, URL: "{{.BaseURL}}/{{pathescape .Secret}}"},
+	}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server echoes the path, so a secret is verified when the call is made with the capture group
+	r.Verify.BodyMatch = "^/tok_live$"
+	if err := r.Verify.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		found []string
+		want  string
+	}{
+		{"one live secret", []string{"token=tok_dead", "token=tok_live"}, verified},
+		{"no live secret", []string{"token=tok_dead", "token=tok_gone"}, invalid},
+	}
+	for _, test := range tests {
+		if got := verifySecrets(r, test.found); got != test.want {
+			t.Errorf("%s: verifySecrets(%q) = %q, want %q", test.name, test.found, got, test.want)
+		}
+	}
+
+	// each secret is only sent once for the whole run
+	if calls := atomic.LoadInt32(&server.calls); calls != 3 {
+		t.Errorf("the API was called %d times, want 3", calls)
+	}
+	if got := verifySecrets(rule{Name: "No verifier"}, []string{"token=tok_live"}); got != "" {
+		t.Errorf("verifySecrets without a verifier = %q, want nothing", got)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// The clones are the bulk of the workspace, so each one is deleted as soon as every scanner is
+// done with it, and the maxDiskUsage flag holds back new clones while the ones on disk use up the budget.
+
+const reposDir = "/tmp/repos/"
+
+// clonesDisposable tells whether the clones can be deleted. They are what downloadOnly is for,
+// and with scanOnly they were mounted by the user.
+func clonesDisposable() bool {
+	return !*keepClones && !*scanOnly && !*downloadOnly
+}
+
+func checkworkspaceflags() error {
+	if *maxDiskUsage < 0 {
+		fmt.Println("maxDiskUsage can't be negative")
+		os.Exit(2)
+	}
+	if *maxDiskUsage > 0 && (*keepClones || *downloadOnly) {
+		fmt.Println("maxDiskUsage can't be used along with keepClones or downloadOnly, as the clones are then never deleted to make room")
+		os.Exit(2)
+	}
+	if *resume && (*shredResults || *encryptKey != "") {
+		fmt.Println("resume can't be used along with shredResults or encryptKey, as an interrupted run shreds the results it would resume from")
+		os.Exit(2)
+	}
+	return nil
+}
+
+// diskUsage keeps track of the size of the clones and documents on disk, and of how many of them
+// are waiting to be scanned and deleted
+type diskUsage struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	used    int64
+	sizes   map[string]int64
+	pending int
+}
+
+var workspace = newDiskUsage()
+
+func newDiskUsage() *diskUsage {
+	w := &diskUsage{sizes: make(map[string]int64)}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// reserve waits until the clones and documents on disk fit in the budget. It gives up when none
+// of them is waiting to be deleted, as then no room is going to be made.
+func (w *diskUsage) reserve() bool {
+	if *maxDiskUsage == 0 {
+		return true
+	}
+	budget := int64(*maxDiskUsage) * 1024 * 1024
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.used >= budget {
+		if w.pending == 0 {
+			return false
+		}
+		w.cond.Wait()
+	}
+	return true
+}
+
+// added adds a new clone, or a source of documents collected through the API, to the disk usage
+func (w *diskUsage) added(path string) {
+	if *maxDiskUsage == 0 {
+		return
+	}
+	size := dirSize(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.used += size
+	w.sizes[path] = size
+	if clonesDisposable() {
+		w.pending++
+	}
+}
+
+// removed wakes up the clones and downloads waiting for room once a clone or documents are done with, deleted or not
+func (w *diskUsage) removed(path string, deleted bool) {
+	if *maxDiskUsage == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending--
+	if deleted {
+		w.used -= w.sizes[path]
+		delete(w.sizes, path)
+	}
+	w.cond.Broadcast()
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// repoInfo is what the merged output needs from a clone, saved next to the results before the clone is deleted.
+// Path is where the clone was, which repo-supervisor's results start with.
+// Refs maps the commits with findings to the refs they are reachable from.
+type repoInfo struct {
+	URL  string              `json:"url"`
+	Path string              `json:"path,omitempty"`
+	Refs map[string][]string `json:"refs,omitempty"`
+}
+
+const repoInfoFile = "repository.json"
+
+// readRepoInfo reads the info saved for a repo, or gets it from the clone when it is still around
+func readRepoInfo(ctx context.Context, repoResultsPath string, repoPath string) repoInfo {
+	var info repoInfo
+	if content, err := ioutil.ReadFile(repoResultsPath + repoInfoFile); err == nil && json.Unmarshal(content, &info) == nil {
+		return info
+	}
+	if repoPath == "" {
+		return info
+	}
+	info.Path = repoPath
+	info.URL, _ = gitRepoURL(ctx, repoPath)
+	if *allRefs {
+		info.Refs = loadRefs(ctx, repoResultsPath, repoPath)
+	}
+	return info
+}
+
+// findClone returns the path of the clone of a repo still on disk, which depends on how the repo was listed,
+// or an empty string when it was deleted
+func findClone(owner string, name string) string {
+	for _, path := range []string{
+		reposDir + "org/" + owner + "/" + name,
+		reposDir + "users/" + owner + "/" + name,
+		reposDir + "team/" + name,
+		reposDir + owner + "/" + name,
+	} {
+		if fileExists(path) {
+			return path + "/"
+		}
+	}
+	return ""
+}
+
+// removeClone deletes a scanned clone, saving what the merged output needs from it first
+func removeClone(ctx context.Context, repoPath string, repoResultsPath string) error {
+	info := readRepoInfo(ctx, repoResultsPath, repoPath)
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(repoResultsPath, 0700)
+	err = ioutil.WriteFile(repoResultsPath+repoInfoFile, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(repoPath)
+}
+
+// cleanupWorkspace deletes whatever clones and documents are left, at the end of the run or when it is interrupted
+func cleanupWorkspace() {
+	if clonesDisposable() {
+		os.RemoveAll(reposDir)
+		os.RemoveAll(documentsDir)
+	}
+	os.Remove(truffleHogRulesPath)
+}
+
+// handleSignals cleans up the workspace when the run is interrupted. The per-repo results are
+// shredded too when they were meant to be shredded or encrypted, as the run won't get that far.
+func handleSignals(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		// no more jobs are started, and the commands running are killed
+		cancel()
+		killProcessGroups()
+		Info("Interrupted (" + sig.String() + "), cleaning up the workspace before exiting")
+		cleanupWorkspace()
+		if *shredResults || *encryptKey != "" {
+			shredIntermediates()
+			// there is nothing left to resume from, which is why resume doesn't go along with these flags
+			os.Remove(journalPath)
+		}
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+}